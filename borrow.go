@@ -0,0 +1,163 @@
+package bucket
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BorrowingChild is a bucket of its own which may borrow the idle tokens of a
+// parent when it runs short, e.g. to lend bursts between tenants sharing a
+// parent. Unlike NewChild, whose takes need the tokens of both buckets, a
+// BorrowingChild only takes from the parent what its own tokens lack, and
+// pays the parent back from its own refills. It is safe to use under
+// concurrency environments.
+type BorrowingChild struct {
+	own         *TokenBucket
+	parent      *TokenBucket
+	maxBorrow   int64
+	mutex       *sync.Mutex
+	borrowed    int64
+	done        chan struct{}
+	destroyOnce *sync.Once
+}
+
+// NewBorrowingChild returns a new BorrowingChild with its own bucket of
+// capability ownCap, which is refilled at the fill interval and by the clock
+// of parent and is initially full. At most maxBorrow tokens can be owed to
+// parent at any time. It panics if ownCap or maxBorrow is negative.
+func NewBorrowingChild(parent *TokenBucket, ownCap, maxBorrow int64) *BorrowingChild {
+	if maxBorrow < 0 {
+		panic(fmt.Sprintf("ratelimit: max borrow %v should not be negative", maxBorrow))
+	}
+
+	own, err := NewBucket(parent.Interval(), ownCap, WithClock(parent.clock))
+
+	if err != nil {
+		panic(err.Error())
+	}
+
+	bc := &BorrowingChild{
+		own:         own,
+		parent:      parent,
+		maxBorrow:   maxBorrow,
+		mutex:       &sync.Mutex{},
+		done:        make(chan struct{}),
+		destroyOnce: &sync.Once{},
+	}
+
+	if own.interval > 0 {
+		// The ticker is created after the one of own, so the own bucket is
+		// refilled before being repaid at the same time.
+		go bc.repayDaemon(own.clock.NewTicker(own.interval))
+	}
+
+	return bc
+}
+
+// TryTake trys to take specified count tokens from the own bucket, borrowing
+// the missing ones from the parent if they are available there and the debt
+// stays within the max. It returns false without taking any token otherwise.
+// It panics if count is greater than the own capability.
+func (bc *BorrowingChild) TryTake(count int64) bool {
+	bc.checkCount(count)
+
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	bc.repay()
+
+	n := bc.own.TryTakeMaxTokens(count)
+
+	if n == count {
+		return true
+	}
+
+	if rest := count - n; bc.borrowed+rest <= bc.maxBorrow && bc.parent.TryTake(rest) {
+		bc.borrowed += rest
+
+		return true
+	}
+
+	if n > 0 {
+		bc.own.Refund(n)
+	}
+
+	return false
+}
+
+// Take takes specified count tokens like TryTake, and if they can not be taken
+// right now, waits for them to be refilled in the own bucket without
+// borrowing. It returns early if the BorrowingChild is destroyed while
+// waiting.
+func (bc *BorrowingChild) Take(count int64) {
+	if !bc.TryTake(count) {
+		bc.own.Take(count)
+	}
+}
+
+// Available returns how many tokens are available in the own bucket.
+func (bc *BorrowingChild) Available() int64 {
+	return bc.own.Available()
+}
+
+// Borrowed returns how many tokens are owed to the parent now.
+func (bc *BorrowingChild) Borrowed() int64 {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	return bc.borrowed
+}
+
+// Destroy destroys the own bucket and gives the tokens still owed back to the
+// parent, which is not destroyed. It is safe to call Destroy more than once.
+func (bc *BorrowingChild) Destroy() {
+	bc.destroyOnce.Do(func() {
+		close(bc.done)
+		bc.own.Destroy()
+
+		bc.mutex.Lock()
+		defer bc.mutex.Unlock()
+
+		if bc.borrowed > 0 {
+			bc.parent.Refund(bc.borrowed)
+			bc.borrowed = 0
+		}
+	})
+}
+
+func (bc *BorrowingChild) checkCount(count int64) {
+	if err := bc.own.countError(count); err != nil {
+		panic(err.Error())
+	}
+}
+
+// repay pays the parent back with the tokens available in the own bucket, it
+// should be called with mutex held.
+func (bc *BorrowingChild) repay() {
+	if bc.borrowed == 0 {
+		return
+	}
+
+	if n := bc.own.TryTakeMaxTokens(bc.borrowed); n > 0 {
+		bc.borrowed -= n
+		bc.parent.Refund(n)
+	}
+}
+
+// repayDaemon repays the parent after every refill of the own bucket, so the
+// parent gets its tokens back even if the child is idle.
+func (bc *BorrowingChild) repayDaemon(ticker Ticker) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bc.done:
+			return
+		case <-ticker.C():
+		}
+
+		bc.mutex.Lock()
+		bc.repay()
+		bc.mutex.Unlock()
+	}
+}
@@ -0,0 +1,108 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBorrowingChild(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should borrow from the parent and repay it with the own refills", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		parent, err := NewBucket(time.Second, 10, WithClock(c), WithInitialTokens(5))
+		assert.Nil(err)
+		defer parent.Destroy()
+
+		bc := NewBorrowingChild(parent, 2, 3)
+		defer bc.Destroy()
+
+		assert.True(bc.TryTake(2))
+		assert.Equal(int64(5), parent.Available())
+
+		assert.True(bc.TryTake(2))
+		assert.Equal(int64(2), bc.Borrowed())
+		assert.Equal(int64(3), parent.Available())
+
+		c.Advance(time.Second)
+		assert.Equal(int64(1), bc.Borrowed())
+		assert.Equal(int64(0), bc.Available())
+		assert.Equal(int64(5), parent.Available())
+
+		c.Advance(time.Second)
+		assert.Equal(int64(0), bc.Borrowed())
+		assert.Equal(int64(7), parent.Available())
+
+		c.Advance(time.Second)
+		assert.Equal(int64(1), bc.Available())
+		assert.Equal(int64(8), parent.Available())
+	})
+
+	t.Run("Should not borrow more than the max", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		parent, err := NewBucket(time.Second, 10, WithClock(c), WithInitialTokens(5))
+		assert.Nil(err)
+		defer parent.Destroy()
+
+		bc := NewBorrowingChild(parent, 2, 2)
+
+		assert.True(bc.TryTake(2))
+		assert.True(bc.TryTake(2))
+		assert.False(bc.TryTake(1))
+		assert.Equal(int64(2), bc.Borrowed())
+		assert.Equal(int64(3), parent.Available())
+
+		c.Advance(time.Second)
+		assert.Equal(int64(1), bc.Borrowed())
+		assert.False(bc.TryTake(2))
+		assert.True(bc.TryTake(1))
+		assert.Equal(int64(2), bc.Borrowed())
+		assert.Equal(int64(4), parent.Available())
+
+		bc.Destroy()
+		assert.Equal(int64(0), bc.Borrowed())
+		assert.Equal(int64(6), parent.Available())
+	})
+
+	t.Run("Should wait for the own tokens when it can not borrow", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		parent, err := NewBucket(time.Second, 10, WithClock(c))
+		assert.Nil(err)
+		defer parent.Destroy()
+
+		bc := NewBorrowingChild(parent, 2, 0)
+		defer bc.Destroy()
+
+		assert.True(bc.TryTake(2))
+
+		done := make(chan struct{})
+
+		go func() {
+			bc.Take(2)
+			close(done)
+		}()
+
+		waitUntil(func() bool { return bc.own.WaitingCount() == 1 })
+		c.Advance(time.Second * 2)
+		<-done
+
+		assert.Equal(int64(0), bc.Available())
+		assert.Equal(int64(10), parent.Available())
+	})
+
+	t.Run("Should panic when arguments are invalid", func(t *testing.T) {
+		parent := New(time.Second, 10)
+		defer parent.Destroy()
+
+		assert.Panics(func() { NewBorrowingChild(parent, 2, -1) })
+		assert.Panics(func() { NewBorrowingChild(parent, -1, 2) })
+
+		bc := NewBorrowingChild(parent, 2, 5)
+		defer bc.Destroy()
+
+		assert.Panics(func() { bc.TryTake(3) })
+		assert.Panics(func() { bc.Take(-1) })
+	})
+}
@@ -1,223 +1,1657 @@
 package bucket
 
 import (
-	"container/list"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrBucketDestroyed is returned by the context aware methods when the bucket
+// is destroyed before the tokens become available.
+var ErrBucketDestroyed = errors.New("token-bucket: bucket is destroyed")
+
+// ErrTooManyWaiters is returned by the context aware methods when the bucket
+// is created WithMaxWaiters and its waiting queue is full.
+var ErrTooManyWaiters = errors.New("token-bucket: too many waiters")
+
+// ErrBucketClosed is returned by the context aware methods when the bucket is
+// being closed by Close and no longer accepts new waiters.
+var ErrBucketClosed = errors.New("token-bucket: bucket is closed")
+
+// ErrRateLimited is returned by TakeOrError when the tokens are not available
+// right now.
+var ErrRateLimited = errors.New("token-bucket: rate limited")
+
+var (
+	errWaitTimeout  = errors.New("token-bucket: wait timeout")
+	errWaitCanceled = errors.New("token-bucket: wait canceled")
+)
+
+// Limiter is implemented by the token buckets, so the wrappers like
+// Middleware can accept other implementations as well.
+type Limiter interface {
+	TryTake(count int64) bool
+	Take(count int64)
+	TakeMaxDuration(count int64, max time.Duration) bool
+	Available() int64
+}
+
+var _ Limiter = (*TokenBucket)(nil)
+
 // TokenBucket represents a token bucket
 // (https://en.wikipedia.org/wiki/Token_bucket) which based on multi goroutines,
 // and is safe to use under concurrency environments.
 type TokenBucket struct {
+	// avail and taken are accessed atomically, since TryTake may take tokens
+	// without tokenMutex, and so are refunded and staleAt, which TotalRefunded
+	// and Healthy read without it. They are kept first for the 64-bit
+	// alignment.
+	avail             int64
+	taken             int64
+	refunded          int64
+	staleAt           int64
+	paused            int32
+	drainWhilePaused  bool
+	resumed           chan struct{}
 	interval          time.Duration
-	ticker            *time.Ticker
+	ticker            Ticker
+	clock             Clock
 	tokenMutex        *sync.Mutex
 	waitingQuqueMutex *sync.Mutex
-	waitingQuque      *list.List
+	waitingQuque      *jobQueue
+	priorityQuque     *jobQueue
 	cap               int64
-	avail             int64
+	quantum           int64
+	perTick           float64
+	fraction          float64
+	lazy              bool
+	leaky             bool
+	parent            *TokenBucket
+	maxWaiters        int
+	room              chan struct{}
+	greedy            bool
+	observer          Observer
+	logger            *slog.Logger
+	rand              *rand.Rand
+	overflow          OverflowPolicy
+	spilled           int64
+	empty             bool
+	onEmpty           func()
+	onRefill          func(avail int64)
+	nextGrant         time.Time
+	lastRefill        time.Time
+	done              chan struct{}
+	destroyOnce       *sync.Once
+	closed            bool
+	waiters           *sync.WaitGroup
+	waits             int64
+	timeouts          int64
+	waitTime          time.Duration
 }
 
+// waitingJob is a goroutine waiting in the FIFO queue. The daemon takes the
+// tokens for it under tokenMutex, marks it granted and signals ready, so the
+// daemon never blocks on a waiter. A sync.Cond would avoid the channel, but it
+// can not be selected together with timeouts, contexts and tb.done, so jobs
+// are pooled with their buffered channel instead.
 type waitingJob struct {
-	ch        chan struct{}
+	ready     chan struct{}
 	need      int64
 	use       int64
-	abandoned bool
+	high      bool
+	granted   bool
+	remaining int64
+	seq       uint64
+	queued    bool
+}
+
+var waitingJobPool = sync.Pool{
+	New: func() interface{} {
+		return &waitingJob{ready: make(chan struct{}, 1)}
+	},
 }
 
 // New returns a new token bucket with specified fill interval and
-// capability. The bucket is initially full.
+// capability. The bucket is initially full. It panics if the interval or
+// capability is invalid, see NewChecked.
+//
+// A zero interval makes a bucket which is never refilled and runs no daemon
+// goroutine, it works like a weighted semaphore of cap tokens which are given
+// back with AddTokens or Refund.
 func New(interval time.Duration, cap int64) *TokenBucket {
-	if interval < 0 {
-		panic(fmt.Sprintf("ratelimit: interval %v should > 0", interval))
+	tb, err := NewChecked(interval, cap)
+
+	if err != nil {
+		panic(err.Error())
 	}
 
-	if cap < 0 {
-		panic(fmt.Sprintf("ratelimit: capability %v should > 0", cap))
+	return tb
+}
+
+// NewChecked returns a new token bucket with specified fill interval and
+// capability, or an error if the interval or the capability is negative. The
+// bucket is initially full.
+func NewChecked(interval time.Duration, cap int64) (*TokenBucket, error) {
+	tb, err := newTokenBucket(interval, cap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tb.start()
+
+	return tb, nil
+}
+
+// NewEmpty returns a new token bucket with specified fill interval and
+// capability like New, but the bucket is initially empty so the tokens have to
+// be accrued over time.
+func NewEmpty(interval time.Duration, cap int64) *TokenBucket {
+	tb, err := newTokenBucket(interval, cap)
+
+	if err != nil {
+		panic(err.Error())
+	}
+
+	tb.avail = 0
+	tb.empty = true
+	tb.start()
+
+	return tb
+}
+
+func newTokenBucket(interval time.Duration, cap int64) (*TokenBucket, error) {
+	if err := checkArgs(interval, cap); err != nil {
+		return nil, err
 	}
 
-	tb := &TokenBucket{
+	return &TokenBucket{
 		interval:          interval,
 		tokenMutex:        &sync.Mutex{},
 		waitingQuqueMutex: &sync.Mutex{},
-		waitingQuque:      list.New(),
+		waitingQuque:      newJobQueue(),
+		priorityQuque:     newJobQueue(),
 		cap:               cap,
 		avail:             cap,
-		ticker:            time.NewTicker(interval),
+		empty:             cap == 0,
+		quantum:           1,
+		clock:             realClock{},
+		lastRefill:        time.Now(),
+		done:              make(chan struct{}),
+		destroyOnce:       &sync.Once{},
+		waiters:           &sync.WaitGroup{},
+	}, nil
+}
+
+// Clone returns a new token bucket configured like this one, e.g. to create
+// many buckets with identical settings per tenant. The new bucket is full and
+// shares nothing but its configuration with this one, it has its own waiting
+// queue and daemon goroutine.
+func (tb *TokenBucket) Clone() *TokenBucket {
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
+	c, err := newTokenBucket(tb.interval, tb.cap)
+
+	if err != nil {
+		panic(err.Error())
 	}
 
-	go tb.adjustDaemon()
+	c.quantum = tb.quantum
+	c.perTick = tb.perTick
+	c.clock = tb.clock
+	c.lazy = tb.lazy
+	c.leaky = tb.leaky
+	c.parent = tb.parent
+	c.maxWaiters = tb.maxWaiters
+	c.greedy = tb.greedy
+	c.observer = tb.observer
+	c.logger = tb.logger
+	c.overflow = tb.overflow
+	c.drainWhilePaused = tb.drainWhilePaused
+	c.lastRefill = c.clock.Now()
 
-	return tb
+	if tb.rand != nil {
+		// rand.Rand is not safe for concurrent use, so the clone draws from
+		// its own source, seeded by this one to stay reproducible.
+		c.rand = rand.New(rand.NewSource(tb.rand.Int63()))
+	}
+
+	if !c.lazy {
+		c.start()
+	}
+
+	return c
+}
+
+func checkArgs(interval time.Duration, cap int64) error {
+	if interval < 0 {
+		return fmt.Errorf("ratelimit: interval %v should not be negative", interval)
+	}
+
+	if cap < 0 {
+		return fmt.Errorf("ratelimit: capability %v should > 0", cap)
+	}
+
+	return nil
+}
+
+// start starts the ticker and the daemon goroutine of the bucket, a bucket
+// with zero interval is never refilled so it needs neither.
+func (tb *TokenBucket) start() {
+	if tb.interval == 0 {
+		return
+	}
+
+	tb.ticker = tb.clock.NewTicker(tb.interval)
+	tb.ticked()
+
+	go tb.adjustDaemon()
 }
 
 // Capability returns the capability of this token bucket.
 func (tb *TokenBucket) Capability() int64 {
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
 	return tb.cap
 }
 
-// Availible returns how many tokens are availible in the bucket.
-func (tb *TokenBucket) Availible() int64 {
+// SetCapacity changes the capability of this token bucket, the available
+// tokens are clamped to the new capability. Waiting jobs which need more
+// tokens than the new capability will not be served until it is raised again.
+func (tb *TokenBucket) SetCapacity(cap int64) {
+	if cap < 0 {
+		panic(fmt.Sprintf("ratelimit: capability %v should > 0", cap))
+	}
+
 	tb.tokenMutex.Lock()
-	defer tb.tokenMutex.Unlock()
+	defer tb.unlock()
+
+	tb.refill()
 
-	return tb.avail
+	tb.cap = cap
+
+	for {
+		avail := tb.loadAvail()
+
+		if avail <= cap || atomic.CompareAndSwapInt64(&tb.avail, avail, cap) {
+			return
+		}
+	}
 }
 
-// TryTake trys to task specified count tokens from the bucket. if there are
-// not enough tokens in the bucket, it will return false.
-func (tb *TokenBucket) TryTake(count int64) bool {
-	return tb.tryTake(count, count)
+// Interval returns the fill interval of this token bucket.
+func (tb *TokenBucket) Interval() time.Duration {
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
+	return tb.interval
 }
 
-// Take tasks specified count tokens from the bucket, if there are
-// not enough tokens in the bucket, it will keep waiting until count tokens are
-// availible and then take them.
-func (tb *TokenBucket) Take(count int64) {
-	tb.waitAndTake(count, count)
+// Rate returns how many tokens are refilled per second, which is zero for a
+// bucket with zero interval.
+func (tb *TokenBucket) Rate() float64 {
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
+	if tb.interval == 0 {
+		return 0
+	}
+
+	if tb.perTick > 0 {
+		return tb.perTick / tb.interval.Seconds()
+	}
+
+	return float64(tb.quantum) / tb.interval.Seconds()
 }
 
-// TakeMaxDuration tasks specified count tokens from the bucket, if there are
-// not enough tokens in the bucket, it will keep waiting until count tokens are
-// availible and then take them or just return false when reach the given max
-// duration.
-func (tb *TokenBucket) TakeMaxDuration(count int64, max time.Duration) bool {
-	return tb.waitAndTakeMaxDuration(count, count, max)
+// SetInterval changes the fill interval of this token bucket without
+// touching the available tokens or the waiting jobs. It panics if the bucket
+// was created with zero interval, which is never refilled.
+func (tb *TokenBucket) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		panic(fmt.Sprintf("ratelimit: interval %v should > 0", interval))
+	}
+
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	if tb.interval == 0 {
+		panic("ratelimit: can not set the interval of a bucket with zero interval")
+	}
+
+	tb.refill()
+
+	tb.interval = interval
+
+	if tb.ticker == nil {
+		return
+	}
+
+	select {
+	case <-tb.done:
+	default:
+		tb.ticker.Reset(interval)
+		tb.lastRefill = tb.clock.Now()
+		tb.ticked()
+	}
 }
 
-// Wait will keep waiting until count tokens are availible in the bucket.
-func (tb *TokenBucket) Wait(count int64) {
-	tb.waitAndTake(count, 0)
+// SetQuantum changes how many tokens are refilled every interval, the next
+// refill uses q without touching the available tokens or the waiting jobs. A
+// bucket created by NewRate is refilled with q whole tokens every interval
+// from then on. It panics if q is not positive.
+func (tb *TokenBucket) SetQuantum(q int64) {
+	if q <= 0 {
+		panic(fmt.Sprintf("ratelimit: quantum %v should > 0", q))
+	}
+
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.refill()
+
+	tb.quantum = q
+	tb.perTick = 0
+	tb.fraction = 0
+
+	tb.serveWaitingJobs()
 }
 
-// WaitMaxDuration will keep waiting until count tokens are availible in the
-// bucket or just return false when reach the given max duration.
-func (tb *TokenBucket) WaitMaxDuration(count int64, max time.Duration) bool {
-	return tb.waitAndTakeMaxDuration(count, 0, max)
+// Availible returns how many tokens are availible in the bucket.
+//
+// Deprecated: Use Available instead.
+func (tb *TokenBucket) Availible() int64 {
+	return tb.Available()
 }
 
-func (tb *TokenBucket) tryTake(need, use int64) bool {
-	tb.checkCount(use)
+// Available returns how many tokens are available in the bucket.
+func (tb *TokenBucket) Available() int64 {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.refill()
+
+	return tb.loadAvail()
+}
 
+// AvailableAt returns how many tokens will be available in the bucket at t
+// if no token is taken or added until then, e.g. to plan future work. It
+// does not change the bucket.
+func (tb *TokenBucket) AvailableAt(t time.Time) int64 {
 	tb.tokenMutex.Lock()
 	defer tb.tokenMutex.Unlock()
 
-	if need <= tb.avail {
-		tb.avail -= use
+	avail := tb.loadAvail()
+
+	if tb.interval == 0 || tb.isPaused() {
+		return avail
+	}
+
+	ticks := int64(t.Sub(tb.lastRefill) / tb.interval)
+
+	if ticks <= 0 {
+		return avail
+	}
+
+	if tb.perTick > 0 {
+		if n := math.Floor(tb.fraction + float64(ticks)*tb.perTick); n < float64(tb.roomFor(avail)) {
+			return avail + int64(n)
+		}
 
-		return true
+		return tb.cap
 	}
 
-	return false
+	return tb.refilled(avail, ticks, tb.quantum)
 }
 
-func (tb *TokenBucket) waitAndTake(need, use int64) {
-	if ok := tb.tryTake(need, use); ok {
-		return
+// WaitingCount returns how many goroutines are waiting for tokens now, which
+// can be used to reject new callers rather than queuing yet another waiter.
+func (tb *TokenBucket) WaitingCount() int {
+	tb.waitingQuqueMutex.Lock()
+	defer tb.waitingQuqueMutex.Unlock()
+
+	return tb.waitingLen()
+}
+
+// String returns a description of the bucket state, which is useful for
+// debugging and logging.
+func (tb *TokenBucket) String() string {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.refill()
+
+	tb.waitingQuqueMutex.Lock()
+	defer tb.waitingQuqueMutex.Unlock()
+
+	return fmt.Sprintf("TokenBucket{cap=%d avail=%d interval=%v waiters=%d}",
+		tb.cap, tb.loadAvail(), tb.interval, tb.waitingLen())
+}
+
+// TryTake trys to task specified count tokens from the bucket. if there are
+// not enough tokens in the bucket, it will return false.
+func (tb *TokenBucket) TryTake(count int64) bool {
+	ok := tb.fastTake(count) || tb.tryTake(count, count)
+
+	if ok {
+		tb.observeTry(count, count)
+	} else {
+		tb.observeTry(count, 0)
+	}
+
+	return ok
+}
+
+// TakeOrError trys to take specified count tokens from the bucket like
+// TryTake, but returns ErrRateLimited instead of false if there are not enough
+// tokens in the bucket, e.g. for handlers returning structured errors.
+func (tb *TokenBucket) TakeOrError(count int64) error {
+	if !tb.TryTake(count) {
+		return ErrRateLimited
 	}
 
-	w := &waitingJob{
-		ch:   make(chan struct{}),
-		use:  use,
-		need: need,
+	return nil
+}
+
+// TryTakeChecked works like TryTake, but returns an error instead of
+// panicking if count is negative or greater than the capability of the
+// bucket, e.g. for counts which come from the outside.
+func (tb *TokenBucket) TryTakeChecked(count int64) (bool, error) {
+	tb.tokenMutex.Lock()
+
+	if err := tb.countError(count); err != nil {
+		tb.tokenMutex.Unlock()
+
+		return false, err
 	}
 
-	tb.addWaitingJob(w)
+	ok := tb.take(count, count)
+	tb.unlock()
 
-	<-w.ch
-	tb.avail -= use
-	w.ch <- struct{}{}
+	if ok {
+		tb.observeTry(count, count)
+	} else {
+		tb.observeTry(count, 0)
+	}
 
-	close(w.ch)
+	return ok, nil
 }
 
-func (tb *TokenBucket) waitAndTakeMaxDuration(need, use int64, max time.Duration) bool {
-	if ok := tb.tryTake(need, use); ok {
-		return true
+// TryTakeAbove trys to take specified count tokens from the bucket like
+// TryTake, but only if at least floor tokens are still available afterwards,
+// so the tokens under the floor are kept for other takers, e.g. the high
+// priority traffic. It panics if floor is negative or greater than the
+// capability of the bucket.
+func (tb *TokenBucket) TryTakeAbove(count, floor int64) bool {
+	ok := tb.tryTakeAbove(count, floor)
+
+	if ok {
+		tb.observeTry(count, count)
+	} else {
+		tb.observeTry(count, 0)
 	}
 
-	w := &waitingJob{
-		ch:   make(chan struct{}),
-		use:  use,
-		need: need,
+	return ok
+}
+
+func (tb *TokenBucket) tryTakeAbove(count, floor int64) bool {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.checkCount(count)
+
+	if floor < 0 || floor > tb.cap {
+		panic(fmt.Sprintf("ratelimit: floor %v should be between 0 and"+
+			" capability %v", floor, tb.cap))
 	}
 
-	defer close(w.ch)
+	return count <= tb.cap-floor && tb.take(count+floor, count)
+}
 
-	tb.addWaitingJob(w)
+// TryTakeN trys to take specified count tokens from the bucket, if there are
+// not enough tokens in the bucket, it takes all the available ones instead. It
+// returns how many tokens are taken, which may be zero.
+func (tb *TokenBucket) TryTakeN(count int64) int64 {
+	n := tb.tryTakeN(count, false)
+	tb.observeTry(count, n)
 
-	select {
-	case <-w.ch:
-		tb.avail -= use
-		w.ch <- struct{}{}
-		return true
-	case <-time.After(max):
-		w.abandoned = true
-		return false
+	return n
+}
+
+// TryTakeMaxTokens takes as many available tokens as possible but no more
+// than max right now, e.g. for consumers draining the bucket in bulk. Unlike
+// TryTakeN, max may exceed the capability of the bucket. It never blocks and
+// returns how many tokens are taken, which may be zero.
+func (tb *TokenBucket) TryTakeMaxTokens(max int64) int64 {
+	if max < 0 {
+		panic(fmt.Sprintf("token-bucket: count %v should not be negative", max))
 	}
+
+	n := tb.tryTakeN(max, true)
+	tb.observeTry(max, n)
+
+	return n
 }
 
-// Destory destorys the token bucket and stop the inner channels.
-func (tb *TokenBucket) Destory() {
-	tb.ticker.Stop()
+// TakeAll takes all the available tokens of the bucket right now and returns
+// how many are taken, which may be zero. It never blocks.
+func (tb *TokenBucket) TakeAll() int64 {
+	n := tb.tryTakeN(math.MaxInt64, true)
+	tb.observeTry(n, n)
+
+	return n
 }
 
-func (tb *TokenBucket) adjustDaemon() {
-	var waitingJobNow *waitingJob
+// tryTakeN takes at most count tokens, count is clamped to the capability if
+// clamp is true, or it panics if count exceeds the capability.
+func (tb *TokenBucket) tryTakeN(count int64, clamp bool) int64 {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
 
-	for range tb.ticker.C {
-		tb.tokenMutex.Lock()
+	if clamp && count > tb.cap {
+		count = tb.cap
+	}
 
-		if tb.avail < tb.cap {
-			tb.avail++
-		}
+	tb.checkCount(count)
 
-		element := tb.getFrontWaitingJob()
+	return tb.takeN(count)
+}
 
-		if element != nil {
-			if waitingJobNow == nil || waitingJobNow.abandoned {
-				waitingJobNow = element.Value.(*waitingJob)
+// takeN takes at most n tokens and returns how many are taken, it should be
+// called with tokenMutex held.
+func (tb *TokenBucket) takeN(n int64) int64 {
+	tb.refill()
 
-				tb.removeWaitingJob(element)
-			}
+	if avail := tb.loadAvail(); n > avail {
+		n = avail
+	}
 
-			if tb.avail >= waitingJobNow.need && !waitingJobNow.abandoned {
-				waitingJobNow.ch <- struct{}{}
-				<-waitingJobNow.ch
+	if n <= 0 || tb.leakyWait() > 0 || !tb.granting() {
+		return 0
+	}
 
-				waitingJobNow = nil
-			}
+	if tb.parent != nil {
+		if n = tb.parent.TryTakeMaxTokens(n); n == 0 {
+			return 0
 		}
+	}
 
-		tb.tokenMutex.Unlock()
+	taken := tb.takeAvailUpTo(n)
+
+	if taken < n && tb.parent != nil {
+		tb.parent.Refund(n - taken)
 	}
+
+	atomic.AddInt64(&tb.taken, taken)
+	tb.leakyGranted(taken)
+
+	return taken
 }
 
-func (tb *TokenBucket) addWaitingJob(w *waitingJob) {
-	tb.waitingQuqueMutex.Lock()
-	tb.waitingQuque.PushBack(w)
-	tb.waitingQuqueMutex.Unlock()
+// Take tasks specified count tokens from the bucket, if there are
+// not enough tokens in the bucket, it will keep waiting until count tokens are
+// available and then take them. If the waiting queue is full, see
+// WithMaxWaiters, it first waits for room in the queue. It returns without
+// taking tokens if the bucket is destroyed while waiting.
+func (tb *TokenBucket) Take(count int64) {
+	tb.waitAndTake(count, count)
 }
 
-func (tb *TokenBucket) getFrontWaitingJob() *list.Element {
-	tb.waitingQuqueMutex.Lock()
-	e := tb.waitingQuque.Front()
-	tb.waitingQuqueMutex.Unlock()
+// TakeOrReject works like Take, but returns false immediately without taking
+// tokens instead of waiting when the waiting queue of the bucket is full, see
+// WithMaxWaiters. It also returns false if the bucket is destroyed while
+// waiting.
+func (tb *TokenBucket) TakeOrReject(count int64) bool {
+	return tb.waitAndTakeUntil(count, count, nil, nil) == nil
+}
+
+// TakeTimed works like Take and returns how long it was blocked waiting for
+// the tokens, which is zero if the tokens were available immediately.
+func (tb *TokenBucket) TakeTimed(count int64) time.Duration {
+	if ok := tb.tryTake(count, count); ok {
+		tb.observeTry(count, count)
+
+		return 0
+	}
+
+	start := tb.clock.Now()
+	tb.waitAndTake(count, count)
 
-	return e
+	return tb.clock.Now().Sub(start)
 }
 
-func (tb *TokenBucket) removeWaitingJob(e *list.Element) {
-	tb.waitingQuqueMutex.Lock()
-	tb.waitingQuque.Remove(e)
-	tb.waitingQuqueMutex.Unlock()
+// TakePriority works like Take, but when high is true the goroutine waits in
+// a separate queue which is always served before the normal one, e.g. for
+// health checks or admin requests. FIFO is kept within each queue. Notice
+// that the normal waiters are starved as long as there are high priority
+// waiters which can not be served yet. Lazy buckets have no waiting queue, so
+// high makes no difference for them.
+func (tb *TokenBucket) TakePriority(count int64, high bool) {
+	tb.waitAndTakeQueued(count, count, high, true, nil, nil)
 }
 
-func (tb *TokenBucket) checkCount(count int64) {
-	if count < 0 || count > tb.cap {
-		panic(fmt.Sprintf("token-bucket: count %v should be less than bucket's"+
-			" capablity %v", count, tb.cap))
+// TakeRemaining takes specified count tokens like Take and returns how many
+// tokens remain in the bucket right after they are taken, which saves a
+// separate Available call racing with the other takers. If Take returns
+// without taking the tokens, it returns the available tokens instead.
+func (tb *TokenBucket) TakeRemaining(count int64) int64 {
+	remaining, err := tb.waitAndTakeQueued(count, count, false, true, nil, nil)
+
+	if err != nil {
+		return tb.Available()
+	}
+
+	return remaining
+}
+
+// TakeMaxDuration tasks specified count tokens from the bucket, if there are
+// not enough tokens in the bucket, it will keep waiting until count tokens are
+// availible and then take them or just return false when reach the given max
+// duration.
+func (tb *TokenBucket) TakeMaxDuration(count int64, max time.Duration) bool {
+	return tb.waitAndTakeMaxDuration(count, count, max)
+}
+
+// TakeResult is the outcome of TakeDetailed.
+type TakeResult struct {
+	// Granted is whether the tokens are taken.
+	Granted bool
+	// Waited is how long the caller was blocked, zero if the tokens were
+	// available immediately.
+	Waited time.Duration
+	// RemainingTokens is how many tokens remain in the bucket right after the
+	// tokens are taken, or the available tokens if they are not.
+	RemainingTokens int64
+	// TimedOut is whether the max duration passed before the tokens were
+	// available.
+	TimedOut bool
+}
+
+// TakeDetailed takes specified count tokens like TakeMaxDuration and reports
+// the whole outcome at once, e.g. for logging or adapting the load.
+func (tb *TokenBucket) TakeDetailed(count int64, max time.Duration) TakeResult {
+	if ok, remaining := tb.tryTakeRemaining(count, count); ok {
+		tb.observeTry(count, count)
+
+		return TakeResult{Granted: true, RemainingTokens: remaining}
+	}
+
+	timer := tb.newTimer(max)
+	defer timer.Stop()
+
+	start := tb.clock.Now()
+	remaining, err := tb.waitAndTakeQueued(count, count, false, false, timer.C(), nil)
+	result := TakeResult{
+		Granted:         err == nil,
+		Waited:          tb.clock.Now().Sub(start),
+		RemainingTokens: remaining,
+		TimedOut:        err == errWaitTimeout,
+	}
+
+	if err != nil {
+		result.RemainingTokens = tb.Available()
+	}
+
+	return result
+}
+
+// TakeBig takes specified count tokens from the bucket like Take, but count
+// may exceed the capability of the bucket: the tokens are taken in chunks of
+// at most the capability, waiting for the bucket to be refilled in between.
+// Notice that it can block for a long time when count is large compared to the
+// fill rate. It returns early if the bucket is destroyed while waiting.
+func (tb *TokenBucket) TakeBig(count int64) {
+	if count < 0 {
+		panic(fmt.Sprintf("token-bucket: count %v should not be negative", count))
 	}
+
+	for count > 0 {
+		n := count
+
+		if cap := tb.Capability(); n > cap {
+			n = cap
+		}
+
+		if n == 0 {
+			panic(fmt.Sprintf("token-bucket: count %v can not be taken from bucket"+
+				" with capability 0", count))
+		}
+
+		if err := tb.waitAndTake(n, n); err != nil {
+			return
+		}
+
+		count -= n
+	}
+}
+
+// TakeProgress takes specified count tokens like TakeBig, but it takes them
+// piece by piece as they become available and calls onProgress with how many
+// of the total count tokens are taken so far after each piece, e.g. to show
+// the progress of a long throttled transfer. onProgress is called without
+// holding the inner mutexes. It returns early if the bucket is destroyed while
+// waiting.
+func (tb *TokenBucket) TakeProgress(count int64, onProgress func(taken, total int64)) {
+	if count < 0 {
+		panic(fmt.Sprintf("token-bucket: count %v should not be negative", count))
+	}
+
+	for taken := int64(0); taken < count; {
+		n := tb.TryTakeMaxTokens(count - taken)
+
+		if n == 0 {
+			tb.tokenMutex.Lock()
+			n = count - taken
+
+			if n > tb.cap {
+				n = tb.cap
+			}
+
+			if n > tb.quantum {
+				n = tb.quantum
+			}
+
+			tb.tokenMutex.Unlock()
+
+			if n == 0 {
+				panic(fmt.Sprintf("token-bucket: count %v can not be taken from bucket"+
+					" with capability 0", count))
+			}
+
+			if err := tb.waitAndTake(n, n); err != nil {
+				return
+			}
+		}
+
+		taken += n
+		onProgress(taken, count)
+	}
+}
+
+// TakeContext tasks specified count tokens from the bucket, if there are
+// not enough tokens in the bucket, it will keep waiting until count tokens are
+// available and then take them or just return ctx.Err() when the context is
+// cancelled or its deadline passes. ErrBucketDestroyed is returned if the
+// bucket is destroyed while waiting, and ErrTooManyWaiters if the waiting
+// queue is full.
+func (tb *TokenBucket) TakeContext(ctx context.Context, count int64) error {
+	return tb.waitAndTakeContext(ctx, count, count)
+}
+
+// TakeOrQuit tasks specified count tokens from the bucket like TakeContext,
+// but for the code using a quit channel instead of a context. It returns false
+// without taking tokens if quit is closed or receives first, or if the bucket
+// is destroyed while waiting.
+func (tb *TokenBucket) TakeOrQuit(count int64, quit <-chan struct{}) bool {
+	return tb.waitAndTakeUntil(count, count, nil, quit) == nil
+}
+
+// TakeMaxDurationContext tasks specified count tokens from the bucket like
+// TakeMaxDuration, but also gives up when the context is cancelled or its
+// deadline passes, whichever comes first. It returns true and nil if the
+// tokens are taken, false and nil if max is reached, and false and ctx.Err()
+// if the context is done. ErrBucketDestroyed is returned if the bucket is
+// destroyed while waiting, and ErrTooManyWaiters if the waiting queue is full.
+func (tb *TokenBucket) TakeMaxDurationContext(ctx context.Context, count int64, max time.Duration) (bool, error) {
+	timer := tb.newTimer(max)
+	defer timer.Stop()
+
+	switch err := tb.waitAndTakeUntil(count, count, timer.C(), ctx.Done()); err {
+	case nil:
+		return true, nil
+	case errWaitTimeout:
+		return false, nil
+	case errWaitCanceled:
+		return false, ctx.Err()
+	default:
+		return false, err
+	}
+}
+
+// TakeChecked works like Take, but returns an error instead of panicking if
+// count is negative or greater than the capability of the bucket. It also
+// returns ErrBucketDestroyed or ErrBucketClosed if the tokens are not taken
+// because the bucket is destroyed or closed, and ErrTooManyWaiters if its
+// waiting queue is full.
+func (tb *TokenBucket) TakeChecked(count int64) error {
+	tb.tokenMutex.Lock()
+	err := tb.countError(count)
+	tb.tokenMutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return tb.waitAndTakeUntil(count, count, nil, nil)
+}
+
+// TakeFunc takes specified count tokens like Take and then runs fn, so the
+// work is kept together with the tokens it needs. fn is not run if Take
+// returns without taking the tokens, e.g. the bucket is destroyed.
+func (tb *TokenBucket) TakeFunc(count int64, fn func()) {
+	if err := tb.waitAndTake(count, count); err == nil {
+		fn()
+	}
+}
+
+// TakeFuncContext takes specified count tokens like TakeContext and then runs
+// fn. fn is not run and the error is returned if the tokens are not taken.
+func (tb *TokenBucket) TakeFuncContext(ctx context.Context, count int64, fn func()) error {
+	if err := tb.TakeContext(ctx, count); err != nil {
+		return err
+	}
+
+	fn()
+
+	return nil
+}
+
+// TakeBefore tasks specified count tokens from the bucket like
+// TakeMaxDuration, but gives up at the absolute deadline. It returns false
+// immediately without taking tokens if the deadline is already passed.
+func (tb *TokenBucket) TakeBefore(count int64, deadline time.Time) bool {
+	max := deadline.Sub(tb.clock.Now())
+
+	if max < 0 {
+		return false
+	}
+
+	return tb.waitAndTakeMaxDuration(count, count, max)
+}
+
+// Wait will keep waiting until count tokens are available in the bucket. It
+// shares the FIFO queue with Take, so it is served in arrival order with the
+// callers taking tokens.
+func (tb *TokenBucket) Wait(count int64) {
+	tb.waitAndTake(count, 0)
+}
+
+// WaitContext will keep waiting until count tokens are available in the
+// bucket or just return ctx.Err() when the context is cancelled or its
+// deadline passes. ErrBucketDestroyed is returned if the bucket is destroyed
+// while waiting.
+func (tb *TokenBucket) WaitContext(ctx context.Context, count int64) error {
+	return tb.waitAndTakeContext(ctx, count, 0)
+}
+
+// WaitMaxDuration will keep waiting until count tokens are availible in the
+// bucket or just return false when reach the given max duration.
+func (tb *TokenBucket) WaitMaxDuration(count int64, max time.Duration) bool {
+	return tb.waitAndTakeMaxDuration(count, 0, max)
+}
+
+// WaitUntilFull will keep waiting until the bucket is full, without taking
+// any token, e.g. to hold the work back until a warm-up is over. It shares the
+// FIFO queue with Take like Wait. The bucket may never be full if its tokens
+// keep being taken elsewhere, it's up to the caller to avoid that.
+func (tb *TokenBucket) WaitUntilFull() {
+	tb.Wait(tb.Capability())
+}
+
+// WaitUntilFullMaxDuration will keep waiting until the bucket is full like
+// WaitUntilFull or just return false when reach the given max duration.
+func (tb *TokenBucket) WaitUntilFullMaxDuration(max time.Duration) bool {
+	return tb.WaitMaxDuration(tb.Capability(), max)
+}
+
+// EstimateWait returns how long it would take until count tokens are
+// available in the bucket now, or zero if they are available right away, e.g.
+// to shed the load instead of waiting too long. It does not take tokens or
+// join the waiting queue, and the goroutines already waiting or tokens taken
+// meanwhile are not accounted for. It panics if count is negative or greater
+// than the capability of the bucket.
+func (tb *TokenBucket) EstimateWait(count int64) time.Duration {
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
+	tb.checkCount(count)
+
+	wait := tb.leakyWait()
+
+	if avail := tb.loadAvail(); count > avail {
+		if d := tb.refillTime(count - avail).Sub(tb.clock.Now()); d > wait {
+			wait = d
+		}
+	}
+
+	if wait < 0 {
+		return 0
+	}
+
+	return wait
+}
+
+// AddTokens puts count tokens into the bucket, the available tokens will not
+// exceed the capability of the bucket. The tokens beyond the capability are
+// discarded unless the bucket is created with OverflowSpill, even with
+// OverflowError, whose errors are only returned by AddTokensChecked. The
+// waiting jobs are served immediately if there are enough tokens for them now.
+func (tb *TokenBucket) AddTokens(count int64) {
+	tb.addTokensChecked(count, false)
+}
+
+// AddTokensChecked puts count tokens into the bucket like AddTokens, but if the
+// bucket is created WithOverflowPolicy(OverflowError) and the tokens would
+// exceed its capability, it adds none of them and returns an error wrapping
+// ErrOverflow.
+func (tb *TokenBucket) AddTokensChecked(count int64) error {
+	return tb.addTokensChecked(count, true)
+}
+
+func (tb *TokenBucket) addTokensChecked(count int64, checked bool) error {
+	if count < 0 {
+		panic(fmt.Sprintf("token-bucket: count %v should not be negative", count))
+	}
+
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.refill()
+
+	if err := tb.addTokens(count, checked); err != nil {
+		return err
+	}
+
+	tb.serveWaitingJobs()
+
+	return nil
+}
+
+// Refund gives back count tokens taken by a prior Take or TryTake, e.g. when
+// the protected operation was not actually performed. Like AddTokens, the
+// available tokens are clamped to the capability of the bucket unless it is
+// created with OverflowSpill.
+func (tb *TokenBucket) Refund(count int64) {
+	tb.AddTokens(count)
+	atomic.AddInt64(&tb.refunded, count)
+
+	if tb.parent != nil {
+		tb.parent.Refund(count)
+	}
+}
+
+// RefundChecked gives back count tokens like Refund, but returns an error
+// wrapping ErrOverflow like AddTokensChecked if they would exceed the
+// capability of a bucket created WithOverflowPolicy(OverflowError). The
+// parent is only refunded once the bucket itself is, so an error of the
+// parent leaves the tokens refunded to the bucket.
+func (tb *TokenBucket) RefundChecked(count int64) error {
+	if err := tb.AddTokensChecked(count); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&tb.refunded, count)
+
+	if tb.parent != nil {
+		return tb.parent.RefundChecked(count)
+	}
+
+	return nil
+}
+
+// Drain discards all the available tokens in the bucket without serving the
+// waiting jobs, and returns how many tokens are discarded.
+func (tb *TokenBucket) Drain() int64 {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.refill()
+
+	for {
+		avail := tb.loadAvail()
+
+		if avail <= 0 {
+			return 0
+		}
+
+		if atomic.CompareAndSwapInt64(&tb.avail, avail, 0) {
+			return avail
+		}
+	}
+}
+
+// Fill tops the bucket up to its capability and serves the waiting jobs
+// which can be satisfied now.
+func (tb *TokenBucket) Fill() {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.refill()
+
+	atomic.StoreInt64(&tb.avail, tb.cap)
+
+	tb.serveWaitingJobs()
+}
+
+// SetAvailable sets the available tokens to n, which is clamped between zero
+// and the capability of the bucket, and serves the waiting jobs which can be
+// satisfied now.
+func (tb *TokenBucket) SetAvailable(n int64) {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.refill()
+
+	if n < 0 {
+		n = 0
+	} else if n > tb.cap {
+		n = tb.cap
+	}
+
+	atomic.StoreInt64(&tb.avail, n)
+
+	tb.serveWaitingJobs()
+}
+
+// Reset makes the bucket full again as if it was just created, e.g. to reuse
+// it across test cases instead of creating a new one: the spilled and the
+// fractional tokens are dropped and the next refill is a whole interval away.
+// The waiting jobs are not released, they are served in order with the
+// tokens of the full bucket and the ones which still can not be satisfied
+// keep waiting. A paused bucket stays paused.
+func (tb *TokenBucket) Reset() {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	atomic.StoreInt64(&tb.avail, tb.cap)
+
+	tb.spilled = 0
+	tb.fraction = 0
+	tb.nextGrant = time.Time{}
+	tb.lastRefill = tb.clock.Now()
+
+	if tb.ticker != nil {
+		select {
+		case <-tb.done:
+		default:
+			tb.ticker.Reset(tb.interval)
+			tb.ticked()
+		}
+	}
+
+	tb.serveWaitingJobs()
+}
+
+func (tb *TokenBucket) tryTake(need, use int64) bool {
+	ok, _ := tb.tryTakeRemaining(need, use)
+
+	return ok
+}
+
+// tryTakeRemaining works like tryTake and also returns the tokens remaining
+// right after the tokens are taken.
+func (tb *TokenBucket) tryTakeRemaining(need, use int64) (bool, int64) {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.checkCount(need)
+
+	return tb.take(need, use), tb.loadAvail()
+}
+
+// take takes use tokens if need tokens are available, it should be called
+// with tokenMutex held.
+func (tb *TokenBucket) take(need, use int64) bool {
+	tb.refill()
+
+	if need > tb.loadAvail() || tb.leakyWait() > 0 || !tb.granting() {
+		return false
+	}
+
+	if tb.parent != nil && !tb.parent.tryTake(need, use) {
+		return false
+	}
+
+	if !tb.takeAvail(need, use) {
+		if tb.parent != nil {
+			tb.parent.Refund(use)
+		}
+
+		return false
+	}
+
+	atomic.AddInt64(&tb.taken, use)
+	tb.leakyGranted(use)
+
+	return true
+}
+
+// fastTake takes count tokens without tokenMutex when the bucket still has
+// tokens left afterwards, so no empty transition can be missed. Lazy and
+// child buckets always need tokenMutex to refill or to ask the parent.
+func (tb *TokenBucket) fastTake(count int64) bool {
+	if tb.lazy || tb.parent != nil || count <= 0 || !tb.granting() {
+		return false
+	}
+
+	for {
+		avail := atomic.LoadInt64(&tb.avail)
+
+		if avail <= count {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&tb.avail, avail, avail-count) {
+			atomic.AddInt64(&tb.taken, count)
+
+			return true
+		}
+	}
+}
+
+func (tb *TokenBucket) loadAvail() int64 {
+	return atomic.LoadInt64(&tb.avail)
+}
+
+// takeAvail takes use tokens if need tokens are available.
+func (tb *TokenBucket) takeAvail(need, use int64) bool {
+	for {
+		avail := tb.loadAvail()
+
+		if need > avail {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&tb.avail, avail, avail-use) {
+			return true
+		}
+	}
+}
+
+// takeAvailUpTo takes at most n tokens and returns how many are taken.
+func (tb *TokenBucket) takeAvailUpTo(n int64) int64 {
+	for {
+		avail := tb.loadAvail()
+		taken := n
+
+		if taken > avail {
+			taken = avail
+		}
+
+		if taken <= 0 {
+			return 0
+		}
+
+		if atomic.CompareAndSwapInt64(&tb.avail, avail, avail-taken) {
+			return taken
+		}
+	}
+}
+
+// addAvail adds ticks*quantum tokens clamped to the capability, without
+// overflowing when ticks, quantum or the capability is large. It should be
+// called with tokenMutex held.
+func (tb *TokenBucket) addAvail(ticks, quantum int64) {
+	for {
+		avail := tb.loadAvail()
+
+		if atomic.CompareAndSwapInt64(&tb.avail, avail, tb.refilled(avail, ticks, quantum)) {
+			return
+		}
+	}
+}
+
+// refilled returns avail plus ticks*quantum tokens clamped to the capability.
+func (tb *TokenBucket) refilled(avail, ticks, quantum int64) int64 {
+	// ticks*quantum < room, and so avail+ticks*quantum < cap. The product may
+	// wrap around when avail is negative, but the sum still fits in int64.
+	if room := tb.roomFor(avail); room > 0 && uint64(ticks) <= (room-1)/uint64(quantum) {
+		return avail + ticks*quantum
+	}
+
+	return tb.cap
+}
+
+// roomFor returns how many tokens can be added to avail before the bucket is
+// full. It is unsigned as cap-avail overflows int64 when avail is negative
+// after a Reserve.
+func (tb *TokenBucket) roomFor(avail int64) uint64 {
+	if avail >= tb.cap {
+		return 0
+	}
+
+	return uint64(tb.cap) - uint64(avail)
+}
+
+// waitAndTake takes use tokens once need tokens are available, and unlike
+// waitAndTakeUntil it waits for room in the queue if it is full. It returns
+// ErrBucketDestroyed or ErrBucketClosed if the tokens are not taken.
+func (tb *TokenBucket) waitAndTake(need, use int64) error {
+	_, err := tb.waitAndTakeQueued(need, use, false, true, nil, nil)
+
+	return err
+}
+
+func (tb *TokenBucket) waitAndTakeMaxDuration(need, use int64, max time.Duration) bool {
+	timer := tb.newTimer(max)
+	defer timer.Stop()
+
+	return tb.waitAndTakeUntil(need, use, timer.C(), nil) == nil
+}
+
+func (tb *TokenBucket) waitAndTakeContext(ctx context.Context, need, use int64) error {
+	if err := tb.waitAndTakeUntil(need, use, nil, ctx.Done()); err != errWaitCanceled {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// waitAndTakeUntil takes use tokens once need tokens are available. It gives
+// up and returns errWaitTimeout or errWaitCanceled when timeout or cancel
+// fires first, ErrBucketDestroyed when the bucket is destroyed, or
+// ErrTooManyWaiters without waiting when the queue is full. A nil channel
+// never fires.
+func (tb *TokenBucket) waitAndTakeUntil(need, use int64, timeout <-chan time.Time, cancel <-chan struct{}) error {
+	_, err := tb.waitAndTakeQueued(need, use, false, false, timeout, cancel)
+
+	return err
+}
+
+// waitAndTakeQueued works like waitAndTakeUntil, the job waits in the high
+// priority queue if high is true, and waits for room in the queue instead of
+// returning ErrTooManyWaiters if block is true. It also returns the tokens
+// remaining right after the tokens are taken.
+func (tb *TokenBucket) waitAndTakeQueued(need, use int64, high, block bool, timeout <-chan time.Time, cancel <-chan struct{}) (int64, error) {
+	if tb.observer == nil && tb.logger == nil {
+		return tb.waitAndTakeJob(need, use, high, block, timeout, cancel)
+	}
+
+	start := tb.clock.Now()
+	remaining, err := tb.waitAndTakeJob(need, use, high, block, timeout, cancel)
+	waited := tb.clock.Now().Sub(start)
+	tb.observeWait(need, use, waited, err)
+	tb.logWait(need, use, waited, err)
+
+	return remaining, err
+}
+
+func (tb *TokenBucket) waitAndTakeJob(need, use int64, high, block bool, timeout <-chan time.Time, cancel <-chan struct{}) (int64, error) {
+	if tb.lazy {
+		return tb.lazyWaitAndTake(need, use, timeout, cancel)
+	}
+
+	if ok, remaining := tb.tryTakeRemaining(need, use); ok {
+		return remaining, nil
+	}
+
+	select {
+	case <-cancel:
+		return 0, errWaitCanceled
+	default:
+	}
+
+	if !tb.enterWait() {
+		return 0, ErrBucketClosed
+	}
+
+	defer tb.waiters.Done()
+
+	start := tb.clock.Now()
+	w := waitingJobPool.Get().(*waitingJob)
+	w.need, w.use, w.high = need, use, high
+
+	for {
+		room := tb.addWaitingJob(w)
+
+		if room == nil {
+			break
+		}
+
+		if !block {
+			waitingJobPool.Put(w)
+
+			return 0, ErrTooManyWaiters
+		}
+
+		select {
+		case <-room:
+		case <-tb.done:
+			waitingJobPool.Put(w)
+
+			return 0, ErrBucketDestroyed
+		}
+
+		// The tokens may be available by the time the queue has room.
+		if ok, remaining := tb.tryTakeRemaining(need, use); ok {
+			waitingJobPool.Put(w)
+			tb.finishWait(start, nil)
+
+			return remaining, nil
+		}
+	}
+
+	tb.logEnqueue(need)
+
+	var err error
+
+	select {
+	case <-w.ready:
+	case <-timeout:
+		err = errWaitTimeout
+	case <-cancel:
+		err = errWaitCanceled
+	case <-tb.done:
+		err = ErrBucketDestroyed
+	}
+
+	if err != nil {
+		// The daemon may have granted the tokens right before the wait ended,
+		// in which case they are already taken for this job.
+		tb.tokenMutex.Lock()
+
+		if w.granted {
+			err = nil
+			<-w.ready
+		} else {
+			tb.removeWaitingJob(w)
+		}
+
+		tb.tokenMutex.Unlock()
+	}
+
+	remaining := w.remaining
+
+	// Nothing refers to the job any more, the channel is drained and it can
+	// be reused by the next wait.
+	w.granted = false
+	waitingJobPool.Put(w)
+
+	tb.finishWait(start, err)
+
+	return remaining, err
+}
+
+// Destory destorys the token bucket.
+//
+// Deprecated: Use Destroy instead.
+func (tb *TokenBucket) Destory() {
+	tb.Destroy()
+}
+
+// Close stops the bucket from accepting new waiters and waits until the
+// goroutines already waiting for tokens are served, then destroys the bucket.
+// If ctx is done first, the remaining waiters are released without taking
+// tokens and ctx.Err() is returned. Once Close is called, Take and the other
+// waiting methods return without taking tokens instead of waiting, and the
+// context aware ones return ErrBucketClosed.
+func (tb *TokenBucket) Close(ctx context.Context) error {
+	tb.tokenMutex.Lock()
+	tb.closed = true
+	tb.tokenMutex.Unlock()
+
+	drained := make(chan struct{})
+
+	go func() {
+		tb.waiters.Wait()
+		close(drained)
+	}()
+
+	var err error
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	tb.Destroy()
+
+	return err
+}
+
+// enterWait registers a new waiter for Close, it returns false if the bucket
+// is closed.
+func (tb *TokenBucket) enterWait() bool {
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
+	if tb.closed {
+		return false
+	}
+
+	tb.waiters.Add(1)
+
+	return true
+}
+
+// Destroy destroys the token bucket and stop the inner channels and the
+// daemon goroutine. Goroutines still waiting for tokens are released without
+// taking them. It is safe to call Destroy more than once.
+func (tb *TokenBucket) Destroy() {
+	tb.destroyOnce.Do(func() {
+		if tb.ticker != nil {
+			tb.ticker.Stop()
+		}
+
+		close(tb.done)
+
+		tb.waitingQuqueMutex.Lock()
+
+		tb.priorityQuque.Clear()
+		tb.waitingQuque.Clear()
+
+		tb.waitingQuqueMutex.Unlock()
+	})
+}
+
+func (tb *TokenBucket) adjustDaemon() {
+	defer func() {
+		// A panic, e.g. from an OnRefill callback, must not leave the bucket
+		// without refilling forever, so the daemon is restarted.
+		if recover() != nil {
+			go tb.adjustDaemon()
+		}
+	}()
+
+	for {
+		select {
+		case <-tb.done:
+			return
+		case <-tb.ticker.C():
+		}
+
+		if added := tb.tick(); added > 0 {
+			tb.logRefill(added)
+		}
+	}
+}
+
+// tick refills the bucket for a tick of the daemon. The tokens are credited
+// for all the intervals elapsed since the last refill, as the ticker drops
+// the ticks the daemon is too slow to receive, e.g. during a GC pause. It
+// returns how many tokens are refilled, which may be off by the tokens taken
+// by TryTake meanwhile.
+func (tb *TokenBucket) tick() int64 {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	now := tb.clock.Now()
+	ticks := int64(now.Sub(tb.lastRefill) / tb.interval)
+
+	if ticks < 1 || tb.isPaused() {
+		ticks = 1
+		tb.lastRefill = now
+	} else {
+		tb.lastRefill = tb.lastRefill.Add(time.Duration(ticks) * tb.interval)
+	}
+
+	tb.ticked()
+
+	if tb.isPaused() {
+		return 0
+	}
+
+	avail := tb.loadAvail()
+	tb.addTicks(ticks)
+	added := tb.loadAvail() - avail
+
+	tb.pourSpilled()
+	tb.serveWaitingJobs()
+
+	return added
+}
+
+// serveWaitingJobs hands tokens to the waiting jobs in FIFO order as long as
+// there are enough tokens for the first one, so a job which needs many tokens
+// is not starved by the smaller ones behind it. It should be called with
+// tokenMutex held.
+func (tb *TokenBucket) serveWaitingJobs() {
+	if !tb.granting() {
+		return
+	}
+
+	for {
+		var w *waitingJob
+
+		if tb.greedy {
+			w = tb.getFittingWaitingJob(tb.loadAvail())
+		} else {
+			w = tb.getFrontWaitingJob()
+		}
+
+		if w == nil {
+			return
+		}
+
+		if tb.loadAvail() < w.need {
+			return
+		}
+
+		if tb.parent != nil && !tb.parent.tryTake(w.need, w.use) {
+			return
+		}
+
+		if !tb.takeAvail(w.need, w.use) {
+			if tb.parent != nil {
+				tb.parent.Refund(w.use)
+			}
+
+			return
+		}
+
+		// The job is removed before it is signaled, the waiter may reuse it
+		// as soon as ready is received.
+		tb.removeWaitingJob(w)
+
+		atomic.AddInt64(&tb.taken, w.use)
+		w.granted = true
+		w.remaining = tb.loadAvail()
+		w.ready <- struct{}{}
+	}
+}
+
+// addWaitingJob enqueues w and returns nil, or if the queue is already full,
+// it returns a channel which is closed once a job leaves the queue.
+func (tb *TokenBucket) addWaitingJob(w *waitingJob) <-chan struct{} {
+	tb.waitingQuqueMutex.Lock()
+	defer tb.waitingQuqueMutex.Unlock()
+
+	select {
+	case <-tb.done:
+		// The bucket is destroyed, the waiter will be released by tb.done.
+		return nil
+	default:
+	}
+
+	if tb.maxWaiters > 0 && tb.waitingLen() >= tb.maxWaiters {
+		if tb.room == nil {
+			tb.room = make(chan struct{})
+		}
+
+		return tb.room
+	}
+
+	tb.queueOf(w).PushBack(w)
+
+	return nil
+}
+
+// getFrontWaitingJob returns the first high priority job, or the first normal
+// one if there is no high priority job.
+func (tb *TokenBucket) getFrontWaitingJob() *waitingJob {
+	tb.waitingQuqueMutex.Lock()
+	defer tb.waitingQuqueMutex.Unlock()
+
+	if w := tb.priorityQuque.Front(); w != nil {
+		return w
+	}
+
+	return tb.waitingQuque.Front()
+}
+
+// getFittingWaitingJob returns the first waiting job which needs no more than
+// avail tokens, the jobs in the priority queue come first.
+func (tb *TokenBucket) getFittingWaitingJob(avail int64) *waitingJob {
+	tb.waitingQuqueMutex.Lock()
+	defer tb.waitingQuqueMutex.Unlock()
+
+	var fitting *waitingJob
+
+	for _, q := range []*jobQueue{tb.priorityQuque, tb.waitingQuque} {
+		q.Each(func(w *waitingJob) bool {
+			if w.need <= avail {
+				fitting = w
+			}
+
+			return fitting == nil
+		})
+
+		if fitting != nil {
+			return fitting
+		}
+	}
+
+	return nil
+}
+
+func (tb *TokenBucket) removeWaitingJob(w *waitingJob) {
+	tb.waitingQuqueMutex.Lock()
+	tb.queueOf(w).Remove(w)
+
+	if tb.room != nil {
+		close(tb.room)
+		tb.room = nil
+	}
+
+	tb.waitingQuqueMutex.Unlock()
+}
+
+func (tb *TokenBucket) queueOf(w *waitingJob) *jobQueue {
+	if w.high {
+		return tb.priorityQuque
+	}
+
+	return tb.waitingQuque
+}
+
+// waitingLen should be called with waitingQuqueMutex held.
+func (tb *TokenBucket) waitingLen() int {
+	return tb.priorityQuque.Len() + tb.waitingQuque.Len()
+}
+
+// checkCount should be called with tokenMutex held.
+func (tb *TokenBucket) checkCount(count int64) {
+	if err := tb.countError(count); err != nil {
+		panic(err.Error())
+	}
+}
+
+// countError returns the error of an invalid count or nil, it should be
+// called with tokenMutex held.
+func (tb *TokenBucket) countError(count int64) error {
+	if count < 0 || count > tb.cap {
+		return fmt.Errorf("token-bucket: count %v should be less than bucket's"+
+			" capablity %v", count, tb.cap)
+	}
+
+	return nil
 }
@@ -1,6 +1,15 @@
 package bucket
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -26,6 +35,36 @@ func TestTokenBucket(t *testing.T) {
 		assert.Panics(func() { New(-time.Minute, -1) })
 	})
 
+	t.Run("Should return an error from NewChecked when interval or cap is invalid", func(t *testing.T) {
+		_, err := NewChecked(-time.Minute, 1)
+		assert.EqualError(err, "ratelimit: interval -1m0s should not be negative")
+
+		_, err = NewChecked(time.Minute, -1)
+		assert.EqualError(err, "ratelimit: capability -1 should > 0")
+	})
+
+	t.Run("Should return a full bucket from NewChecked", func(t *testing.T) {
+		b, err := NewChecked(time.Minute, 10)
+		assert.Nil(err)
+		defer b.Destory()
+
+		assert.Equal(int64(10), b.Availible())
+	})
+
+	t.Run("Should stop the daemon goroutine when destoryed", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+
+		for i := 0; i < 100; i++ {
+			b := New(time.Millisecond, 1)
+			b.Destory()
+			b.Destory()
+		}
+
+		time.Sleep(time.Millisecond * 100)
+
+		assert.True(runtime.NumGoroutine() <= before)
+	})
+
 	t.Run("Should panic the count pass to checkCount is negative", func(t *testing.T) {
 		b := New(time.Minute, 1)
 		defer b.Destory()
@@ -134,4 +173,1432 @@ func TestTokenBucket(t *testing.T) {
 		assert.False(b.WaitMaxDuration(1, time.Second*2))
 		assert.Equal(int64(0), b.avail)
 	})
+
+	t.Run("Should take until count tokens available using TakeContext", func(t *testing.T) {
+		start := time.Now()
+		b := New(time.Second*2, 1)
+		defer b.Destory()
+
+		assert.True(b.TryTake(1))
+		assert.Nil(b.TakeContext(context.Background(), 1))
+		assert.True(time.Now().Sub(start) > time.Second)
+		assert.Equal(int64(0), b.avail)
+	})
+
+	t.Run("Should return ctx.Err() when context is done before TakeContext gets tokens", func(t *testing.T) {
+		b := New(time.Second*10, 1)
+		defer b.Destory()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		assert.True(b.TryTake(1))
+		assert.Equal(context.DeadlineExceeded, b.TakeContext(ctx, 1))
+		assert.Equal(int64(0), b.avail)
+	})
+
+	t.Run("Should still take available tokens when context is already cancelled", func(t *testing.T) {
+		b := New(time.Minute, 2)
+		defer b.Destory()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.Nil(b.TakeContext(ctx, 1))
+		assert.Equal(int64(1), b.avail)
+		assert.Equal(context.Canceled, b.TakeContext(ctx, 2))
+		assert.Equal(int64(1), b.avail)
+	})
+
+	t.Run("Should give up TakeOrQuit when quit is closed", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 1, WithClock(c), WithInitialTokens(0))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		quit := make(chan struct{})
+		done := make(chan bool)
+
+		go func() {
+			done <- b.TakeOrQuit(1, quit)
+		}()
+
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		close(quit)
+		assert.False(<-done)
+		assert.Equal(0, b.WaitingCount())
+
+		c.Advance(time.Second)
+		assert.Equal(int64(1), b.Available())
+		assert.True(b.TakeOrQuit(1, nil))
+		assert.Equal(int64(0), b.Available())
+	})
+
+	t.Run("Should wait until count tokens available using WaitContext", func(t *testing.T) {
+		start := time.Now()
+		b := New(time.Second*2, 1)
+		defer b.Destory()
+
+		assert.True(b.TryTake(1))
+		assert.Nil(b.WaitContext(context.Background(), 1))
+		assert.True(time.Now().Sub(start) > time.Second)
+		assert.Equal(int64(1), b.avail)
+	})
+
+	t.Run("Should keep serving other waiters after WaitContext is cancelled", func(t *testing.T) {
+		start := time.Now()
+		b := New(time.Second, 1)
+		defer b.Destory()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+
+		assert.True(b.TryTake(1))
+		assert.Equal(context.DeadlineExceeded, b.WaitContext(ctx, 1))
+		assert.Equal(int64(0), b.avail)
+
+		b.Take(1)
+
+		assert.True(time.Now().Sub(start) < time.Second*3)
+		assert.Equal(int64(0), b.avail)
+	})
+
+	t.Run("Should release the waiters when destoryed", func(t *testing.T) {
+		b := New(time.Minute, 1)
+
+		assert.True(b.TryTake(1))
+
+		taken := make(chan struct{})
+		errs := make(chan error)
+
+		go func() {
+			b.Take(1)
+			close(taken)
+		}()
+
+		go func() {
+			errs <- b.TakeContext(context.Background(), 1)
+		}()
+
+		time.Sleep(time.Millisecond * 100)
+		b.Destory()
+
+		select {
+		case <-taken:
+		case <-time.After(time.Second):
+			t.Fatal("Take is not released after Destory")
+		}
+
+		select {
+		case err := <-errs:
+			assert.Equal(ErrBucketDestroyed, err)
+		case <-time.After(time.Second):
+			t.Fatal("TakeContext is not released after Destory")
+		}
+
+		assert.False(b.TakeMaxDuration(1, time.Minute))
+		assert.Equal(0, b.waitingQuque.Len())
+	})
+
+	t.Run("Should not race when many goroutines take concurrently", func(t *testing.T) {
+		b := New(time.Millisecond, 10)
+		defer b.Destory()
+
+		wg := &sync.WaitGroup{}
+
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				b.Take(1)
+				b.Availible()
+			}()
+		}
+
+		wg.Wait()
+
+		assert.True(b.Availible() < 10)
+	})
+
+	t.Run("Should remove timed out jobs from the waiting queue", func(t *testing.T) {
+		start := time.Now()
+		b := New(time.Millisecond*200, 1)
+		defer b.Destory()
+
+		assert.True(b.TryTake(1))
+
+		wg := &sync.WaitGroup{}
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			b.Take(1)
+		}()
+
+		time.Sleep(time.Millisecond * 10)
+		go func() {
+			defer wg.Done()
+			assert.False(b.TakeMaxDuration(1, time.Millisecond*50))
+			b.Take(1)
+		}()
+
+		time.Sleep(time.Millisecond * 100)
+		b.waitingQuqueMutex.Lock()
+		assert.Equal(2, b.waitingQuque.Len())
+		b.waitingQuqueMutex.Unlock()
+
+		wg.Wait()
+
+		assert.True(time.Now().Sub(start) < time.Millisecond*550)
+	})
+
+	t.Run("Should return the time spent waiting from TakeTimed", func(t *testing.T) {
+		b := New(time.Millisecond*200, 1)
+		defer b.Destory()
+
+		assert.Equal(time.Duration(0), b.TakeTimed(1))
+
+		waited := b.TakeTimed(1)
+
+		assert.True(waited > time.Millisecond*100)
+		assert.True(waited < time.Millisecond*400)
+		assert.Equal(int64(0), b.Availible())
+	})
+
+	t.Run("Should add tokens without exceeding the capability", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destory()
+
+		assert.True(b.TryTake(4))
+
+		b.AddTokens(2)
+		assert.Equal(int64(3), b.Availible())
+
+		b.AddTokens(10)
+		assert.Equal(int64(5), b.Availible())
+
+		assert.Panics(func() { b.AddTokens(-1) })
+	})
+
+	t.Run("Should serve the waiting job immediately after adding tokens", func(t *testing.T) {
+		b := New(time.Minute, 2)
+		defer b.Destory()
+
+		assert.True(b.TryTake(2))
+
+		done := make(chan struct{})
+
+		go func() {
+			b.Take(2)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 50)
+		b.AddTokens(2)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Take is not served after AddTokens")
+		}
+
+		assert.Equal(int64(0), b.Availible())
+	})
+
+	t.Run("Should clamp refunded tokens to the capability", func(t *testing.T) {
+		b := New(time.Minute, 3)
+		defer b.Destory()
+
+		assert.True(b.TryTake(2))
+
+		b.Refund(5)
+		assert.Equal(int64(3), b.Availible())
+	})
+
+	t.Run("Should wake a blocked Wait after refund", func(t *testing.T) {
+		b := New(time.Minute, 3)
+		defer b.Destory()
+
+		b.Take(3)
+
+		done := make(chan struct{})
+
+		go func() {
+			b.Wait(3)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 50)
+		b.Refund(3)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Wait is not served after Refund")
+		}
+
+		assert.Equal(int64(3), b.Availible())
+	})
+
+	t.Run("Should clamp available tokens when capacity is lowered", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destory()
+
+		b.SetCapacity(4)
+
+		assert.Equal(int64(4), b.Capability())
+		assert.Equal(int64(4), b.Availible())
+		assert.Panics(func() { b.TryTake(5) })
+		assert.Panics(func() { b.SetCapacity(-1) })
+
+		b.SetCapacity(8)
+
+		assert.Equal(int64(8), b.Capability())
+		assert.Equal(int64(4), b.Availible())
+		assert.True(b.TryTake(4))
+	})
+
+	t.Run("Should refill with the new interval after SetInterval", func(t *testing.T) {
+		start := time.Now()
+		b := New(time.Minute, 1)
+		defer b.Destory()
+
+		assert.True(b.TryTake(1))
+		assert.Panics(func() { b.SetInterval(0) })
+
+		b.SetInterval(time.Millisecond * 100)
+		b.Take(1)
+
+		assert.True(time.Now().Sub(start) < time.Second)
+	})
+
+	t.Run("Should refill with the new quantum after SetQuantum", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 10, WithClock(c), WithInitialTokens(0))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		for i := 0; i < 4; i++ {
+			go b.Take(1)
+		}
+
+		waitUntil(func() bool { return b.WaitingCount() == 4 })
+
+		c.Advance(time.Second)
+		assert.Equal(3, b.WaitingCount())
+
+		assert.Panics(func() { b.SetQuantum(0) })
+		b.SetQuantum(3)
+
+		c.Advance(time.Second)
+		assert.Equal(0, b.WaitingCount())
+
+		c.Advance(time.Second)
+		assert.Equal(int64(3), b.Available())
+	})
+
+	t.Run("Should serve as many waiting jobs as tokens allow at once", func(t *testing.T) {
+		b := New(time.Minute, 3)
+		defer b.Destory()
+
+		assert.True(b.TryTake(3))
+
+		wg := &sync.WaitGroup{}
+
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				b.Take(1)
+			}()
+		}
+
+		time.Sleep(time.Millisecond * 50)
+		b.AddTokens(3)
+
+		done := make(chan struct{})
+
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Waiting jobs are not served at once")
+		}
+
+		assert.Equal(int64(0), b.Availible())
+	})
+
+	t.Run("Should not serve smaller jobs ahead of the front job", func(t *testing.T) {
+		b := New(time.Minute, 3)
+		defer b.Destory()
+
+		assert.True(b.TryTake(3))
+
+		big := make(chan struct{})
+		small := make(chan struct{})
+
+		go func() {
+			b.Take(3)
+			close(big)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+
+		go func() {
+			b.Take(1)
+			close(small)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+		b.AddTokens(2)
+
+		select {
+		case <-small:
+			t.Fatal("Small job is served ahead of the front job")
+		case <-time.After(time.Millisecond * 100):
+		}
+
+		b.AddTokens(1)
+		<-big
+
+		b.AddTokens(1)
+		<-small
+
+		assert.Equal(int64(0), b.Availible())
+	})
+
+	t.Run("Should init the bucket from NewEmpty with no tokens", func(t *testing.T) {
+		b := NewEmpty(time.Millisecond*100, 5)
+		defer b.Destory()
+
+		assert.Equal(int64(5), b.Capability())
+		assert.Equal(int64(0), b.Availible())
+		assert.False(b.TryTake(1))
+
+		time.Sleep(time.Millisecond * 150)
+
+		assert.True(b.TryTake(1))
+		assert.Panics(func() { NewEmpty(time.Minute, -1) })
+	})
+
+	t.Run("Should return the same tokens from Available and Availible", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destory()
+
+		assert.True(b.TryTake(2))
+		assert.Equal(int64(3), b.Available())
+		assert.Equal(b.Available(), b.Availible())
+	})
+
+	t.Run("Should release the waiters when destroyed with Destroy", func(t *testing.T) {
+		b := New(time.Minute, 1)
+
+		assert.True(b.TryTake(1))
+
+		errs := make(chan error)
+
+		go func() {
+			errs <- b.TakeContext(context.Background(), 1)
+		}()
+
+		time.Sleep(time.Millisecond * 50)
+		b.Destroy()
+		b.Destory()
+
+		assert.Equal(ErrBucketDestroyed, <-errs)
+	})
+
+	t.Run("Should describe the bucket state with String", func(t *testing.T) {
+		b := New(time.Second, 10)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(10))
+
+		go b.Take(1)
+		time.Sleep(time.Millisecond * 50)
+
+		assert.Equal("TokenBucket{cap=10 avail=0 interval=1s waiters=1}", b.String())
+		assert.Equal(b.String(), fmt.Sprintf("%v", b))
+	})
+
+	t.Run("Should take as many tokens as available with TryTakeN", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destroy()
+
+		assert.Equal(int64(2), b.TryTakeN(2))
+		assert.Equal(int64(3), b.TryTakeN(3))
+		assert.Equal(int64(0), b.TryTakeN(1))
+
+		b.AddTokens(2)
+
+		assert.Equal(int64(2), b.TryTakeN(5))
+		assert.Equal(int64(0), b.Available())
+		assert.Panics(func() { b.TryTakeN(-1) })
+		assert.Panics(func() { b.TryTakeN(6) })
+	})
+
+	t.Run("Should take more tokens than the capability with TakeBig", func(t *testing.T) {
+		start := time.Now()
+		b := New(time.Millisecond*50, 2)
+		defer b.Destroy()
+
+		b.TakeBig(5)
+
+		assert.True(time.Now().Sub(start) >= time.Millisecond*150)
+		assert.Equal(int64(5), b.Stats().Taken)
+		assert.Panics(func() { b.TakeBig(-1) })
+	})
+
+	t.Run("Should report the progress with TakeProgress", func(t *testing.T) {
+		start := time.Now()
+		b, err := NewBucket(time.Millisecond*20, 4, WithQuantum(2))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		var progress []int64
+
+		b.TakeProgress(9, func(taken, total int64) {
+			assert.Equal(int64(9), total)
+			progress = append(progress, taken)
+		})
+
+		assert.True(time.Since(start) >= time.Millisecond*60)
+		assert.Equal(int64(9), b.Stats().Taken)
+		assert.Equal(int64(4), progress[0])
+		assert.Equal(int64(9), progress[len(progress)-1])
+
+		for i := 1; i < len(progress); i++ {
+			assert.True(progress[i] > progress[i-1])
+		}
+
+		b.TakeProgress(0, func(taken, total int64) { t.Fatal("no progress expected") })
+		assert.Panics(func() { b.TakeProgress(-1, func(taken, total int64) {}) })
+	})
+
+	t.Run("Should discard all the available tokens with Drain", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(1))
+		assert.Equal(int64(4), b.Drain())
+		assert.Equal(int64(0), b.Drain())
+		assert.False(b.TryTake(1))
+		assert.Equal(int64(0), b.Available())
+	})
+
+	t.Run("Should top the bucket up and serve the waiters with Fill", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destroy()
+
+		assert.Equal(int64(5), b.Drain())
+
+		done := make(chan struct{})
+
+		go func() {
+			b.Wait(5)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 50)
+		b.Fill()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Wait is not served after Fill")
+		}
+
+		assert.Equal(int64(5), b.Available())
+	})
+
+	t.Run("Should return false immediately when the deadline is passed", func(t *testing.T) {
+		b := New(time.Minute, 1)
+		defer b.Destroy()
+
+		assert.False(b.TakeBefore(1, time.Now().Add(-time.Second)))
+		assert.Equal(int64(1), b.Available())
+	})
+
+	t.Run("Should take before a future deadline", func(t *testing.T) {
+		b := New(time.Millisecond*50, 1)
+		defer b.Destroy()
+
+		assert.True(b.TakeBefore(1, time.Now().Add(time.Second)))
+		assert.True(b.TakeBefore(1, time.Now().Add(time.Second)))
+		assert.False(b.TakeBefore(1, time.Now().Add(time.Millisecond*10)))
+	})
+
+	t.Run("Should count only the granted tokens when waiters time out concurrently", func(t *testing.T) {
+		b := New(time.Millisecond, 1)
+		defer b.Destroy()
+
+		var granted int64
+		var wg sync.WaitGroup
+
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 20; j++ {
+					if b.TakeMaxDuration(1, time.Millisecond) {
+						atomic.AddInt64(&granted, 1)
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		assert.Equal(granted, b.Stats().Taken)
+		assert.Equal(0, b.Stats().Waiting)
+	})
+
+	t.Run("Should never take more tokens than available with concurrent TryTake", func(t *testing.T) {
+		b := New(time.Minute, 1000)
+		defer b.Destroy()
+
+		var granted, emptied int64
+		var wg sync.WaitGroup
+
+		b.OnEmpty(func() { atomic.AddInt64(&emptied, 1) })
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 200; j++ {
+					if b.TryTake(1) {
+						atomic.AddInt64(&granted, 1)
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		assert.Equal(int64(1000), granted)
+		assert.Equal(int64(1000), b.Stats().Taken)
+		assert.Equal(int64(0), b.Available())
+		assert.Equal(int64(1), atomic.LoadInt64(&emptied))
+	})
+
+	t.Run("Should count the waiting goroutines with WaitingCount", func(t *testing.T) {
+		b := NewEmpty(time.Minute, 5)
+		defer b.Destroy()
+
+		assert.Equal(0, b.WaitingCount())
+
+		for i := 0; i < 3; i++ {
+			go b.Take(1)
+		}
+
+		time.Sleep(time.Millisecond * 50)
+		assert.Equal(3, b.WaitingCount())
+
+		b.AddTokens(1)
+		assert.Equal(2, b.WaitingCount())
+
+		b.AddTokens(2)
+		assert.Equal(0, b.WaitingCount())
+	})
+
+	t.Run("Should serve the high priority waiters first with TakePriority", func(t *testing.T) {
+		b := NewEmpty(time.Minute, 5)
+		defer b.Destroy()
+
+		order := make(chan string, 4)
+
+		for _, name := range []string{"low1", "high1", "low2", "high2"} {
+			name := name
+
+			go func() {
+				b.TakePriority(1, strings.HasPrefix(name, "high"))
+				order <- name
+			}()
+
+			time.Sleep(time.Millisecond * 20)
+		}
+
+		assert.Equal(4, b.WaitingCount())
+
+		for _, name := range []string{"high1", "high2", "low1", "low2"} {
+			b.AddTokens(1)
+			assert.Equal(name, <-order)
+		}
+	})
+
+	t.Run("Should serve the waiting goroutines before Close returns", func(t *testing.T) {
+		b := NewEmpty(time.Millisecond*20, 5)
+
+		var served int64
+
+		for i := 0; i < 3; i++ {
+			go func() {
+				b.Take(1)
+				atomic.AddInt64(&served, 1)
+			}()
+		}
+
+		time.Sleep(time.Millisecond * 10)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		assert.Nil(b.Close(ctx))
+		assert.Equal(int64(3), atomic.LoadInt64(&served))
+		assert.Equal(ErrBucketClosed, b.TakeContext(context.Background(), 1))
+	})
+
+	t.Run("Should release the waiting goroutines when Close times out", func(t *testing.T) {
+		b := NewEmpty(time.Minute, 1)
+
+		done := make(chan error)
+
+		go func() {
+			done <- b.TakeContext(context.Background(), 1)
+		}()
+
+		time.Sleep(time.Millisecond * 10)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+
+		assert.Equal(context.DeadlineExceeded, b.Close(ctx))
+		assert.Equal(ErrBucketDestroyed, <-done)
+	})
+
+	t.Run("Should set the available tokens clamped to the capability", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destroy()
+
+		b.SetAvailable(10)
+		assert.Equal(int64(5), b.Available())
+
+		b.SetAvailable(-1)
+		assert.Equal(int64(0), b.Available())
+
+		done := make(chan struct{})
+
+		go func() {
+			b.Take(2)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+		b.SetAvailable(3)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Take is not served after SetAvailable")
+		}
+
+		assert.Equal(int64(1), b.Available())
+	})
+
+	t.Run("Should keep serving after many TakeMaxDuration calls time out", func(t *testing.T) {
+		b := NewEmpty(time.Millisecond, 3)
+		defer b.Destroy()
+
+		var granted int64
+		var wg sync.WaitGroup
+
+		for i := 0; i < 200; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				if b.TakeMaxDuration(int64(i%3+1), time.Duration(i%5)*time.Millisecond) {
+					atomic.AddInt64(&granted, int64(i%3+1))
+				}
+			}(i)
+
+			if i%20 == 0 {
+				b.AddTokens(3)
+			}
+		}
+
+		wg.Wait()
+
+		assert.Equal(granted, b.Stats().Taken)
+		assert.Equal(0, b.WaitingCount())
+		assert.True(b.TakeMaxDuration(3, time.Second))
+	})
+
+	t.Run("Should serve Wait and Take callers in arrival order", func(t *testing.T) {
+		b := NewEmpty(time.Minute, 5)
+		defer b.Destroy()
+
+		waited := make(chan struct{})
+		taken := make(chan struct{})
+
+		go func() {
+			b.Wait(2)
+			close(waited)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+
+		go func() {
+			b.Take(1)
+			close(taken)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+
+		// The Take behind the Wait is not served even if there are enough
+		// tokens for it.
+		b.AddTokens(1)
+
+		select {
+		case <-taken:
+			t.Fatal("Take is served before the Wait in front of it")
+		case <-time.After(time.Millisecond * 20):
+		}
+
+		b.AddTokens(1)
+
+		<-waited
+		<-taken
+
+		assert.Equal(int64(1), b.Available())
+	})
+
+	t.Run("Should not serve a Wait behind a Take which consumes the token", func(t *testing.T) {
+		b := NewEmpty(time.Minute, 5)
+		defer b.Destroy()
+
+		taken := make(chan struct{})
+
+		go func() {
+			b.Take(1)
+			close(taken)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+
+		go b.Wait(1)
+
+		time.Sleep(time.Millisecond * 20)
+
+		b.AddTokens(1)
+		<-taken
+
+		assert.Equal(1, b.WaitingCount())
+		assert.Equal(int64(0), b.Available())
+	})
+
+	t.Run("Should run fn once the tokens are taken with TakeFunc", func(t *testing.T) {
+		b := New(time.Minute, 2)
+		defer b.Destroy()
+
+		calls := 0
+
+		b.TakeFunc(2, func() { calls++ })
+		assert.Equal(1, calls)
+		assert.Equal(int64(0), b.Available())
+
+		assert.Nil(b.TakeFuncContext(context.Background(), 0, func() { calls++ }))
+		assert.Equal(2, calls)
+	})
+
+	t.Run("Should not run fn when TakeFuncContext is cancelled", func(t *testing.T) {
+		b := NewEmpty(time.Minute, 2)
+		defer b.Destroy()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+
+		calls := 0
+
+		assert.Equal(context.DeadlineExceeded, b.TakeFuncContext(ctx, 1, func() { calls++ }))
+		assert.Equal(0, calls)
+
+		b.Destroy()
+		b.TakeFunc(1, func() { calls++ })
+		assert.Equal(0, calls)
+	})
+
+	t.Run("Should return the remaining tokens with TakeRemaining", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destroy()
+
+		assert.Equal(int64(3), b.TakeRemaining(2))
+		assert.Equal(int64(3), b.Available())
+
+		b.Drain()
+
+		done := make(chan int64)
+
+		go func() {
+			done <- b.TakeRemaining(2)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+		b.AddTokens(3)
+
+		assert.Equal(int64(1), <-done)
+		assert.Equal(int64(1), b.Available())
+	})
+
+	t.Run("Should return the current fill interval", func(t *testing.T) {
+		b := New(time.Second, 5)
+		defer b.Destroy()
+
+		assert.Equal(time.Second, b.Interval())
+
+		b.SetInterval(time.Minute)
+		assert.Equal(time.Minute, b.Interval())
+	})
+
+	t.Run("Should not consume any token when TakeMaxDuration times out", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(3))
+
+		assert.False(b.TakeMaxDuration(4, time.Millisecond*20))
+		assert.Equal(int64(2), b.Available())
+		assert.Equal(int64(3), b.Stats().Taken)
+
+		assert.False(b.WaitMaxDuration(4, time.Millisecond*20))
+		assert.Equal(int64(2), b.Available())
+	})
+
+	t.Run("Should project the available tokens with AvailableAt", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 20, WithClock(c), WithQuantum(2), WithInitialTokens(1))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		now := c.Now()
+
+		assert.Equal(int64(1), b.AvailableAt(now))
+		assert.Equal(int64(3), b.AvailableAt(now.Add(time.Second)))
+		assert.Equal(int64(21-2), b.AvailableAt(now.Add(time.Second*9)))
+		assert.Equal(int64(20), b.AvailableAt(now.Add(time.Second*10)))
+		assert.Equal(int64(1), b.Available())
+
+		c.Advance(time.Second)
+		assert.Equal(int64(3), b.Available())
+		assert.Equal(int64(3), b.AvailableAt(c.Now().Add(time.Millisecond*999)))
+	})
+
+	t.Run("Should return ErrRateLimited with TakeOrError", func(t *testing.T) {
+		b := New(time.Minute, 2)
+		defer b.Destroy()
+
+		assert.Nil(b.TakeOrError(2))
+
+		err := b.TakeOrError(1)
+		assert.True(errors.Is(err, ErrRateLimited))
+		assert.True(errors.Is(fmt.Errorf("handler: %w", err), ErrRateLimited))
+		assert.Equal(int64(0), b.Available())
+	})
+
+	t.Run("Should keep the tokens under the floor with TryTakeAbove", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destroy()
+
+		assert.True(b.TryTakeAbove(7, 3))
+		assert.Equal(int64(3), b.Available())
+
+		assert.False(b.TryTakeAbove(1, 3))
+		assert.Equal(int64(3), b.Available())
+
+		assert.True(b.TryTakeAbove(1, 2))
+		assert.True(b.TryTakeAbove(2, 0))
+		assert.Equal(int64(0), b.Available())
+
+		b.AddTokens(10)
+		assert.False(b.TryTakeAbove(1, 10))
+		assert.True(b.TryTakeAbove(0, 10))
+		assert.True(b.TryTakeAbove(10, 0))
+
+		assert.Panics(func() { b.TryTakeAbove(1, -1) })
+		assert.Panics(func() { b.TryTakeAbove(1, 11) })
+		assert.Panics(func() { b.TryTakeAbove(11, 0) })
+	})
+
+	t.Run("Should return errors for invalid counts with TakeChecked", func(t *testing.T) {
+		b := New(time.Minute, 2)
+		defer b.Destroy()
+
+		assert.NotPanics(func() {
+			assert.EqualError(b.TakeChecked(-1), "token-bucket: count -1 should be less than bucket's capablity 2")
+			assert.EqualError(b.TakeChecked(3), "token-bucket: count 3 should be less than bucket's capablity 2")
+
+			ok, err := b.TryTakeChecked(-1)
+			assert.False(ok)
+			assert.NotNil(err)
+
+			ok, err = b.TryTakeChecked(3)
+			assert.False(ok)
+			assert.EqualError(err, "token-bucket: count 3 should be less than bucket's capablity 2")
+		})
+
+		assert.Equal(int64(2), b.Available())
+
+		ok, err := b.TryTakeChecked(1)
+		assert.True(ok)
+		assert.Nil(err)
+
+		assert.Nil(b.TakeChecked(1))
+		assert.Equal(int64(0), b.Available())
+
+		ok, err = b.TryTakeChecked(1)
+		assert.False(ok)
+		assert.Nil(err)
+
+		b.Destroy()
+		assert.Equal(ErrBucketDestroyed, b.TakeChecked(1))
+	})
+
+	t.Run("Should report the outcome with TakeDetailed", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 3, WithClock(c))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		assert.Equal(TakeResult{Granted: true, RemainingTokens: 1}, b.TakeDetailed(2, time.Second))
+
+		results := make(chan TakeResult)
+
+		go func() {
+			results <- b.TakeDetailed(2, time.Second*2)
+		}()
+
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		c.Advance(time.Second)
+		assert.Equal(TakeResult{Granted: true, Waited: time.Second, RemainingTokens: 0}, <-results)
+
+		go func() {
+			results <- b.TakeDetailed(3, time.Millisecond*1500)
+		}()
+
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		c.Advance(time.Millisecond * 1500)
+		assert.Equal(TakeResult{Waited: time.Millisecond * 1500, RemainingTokens: 1, TimedOut: true}, <-results)
+		assert.Equal(0, b.WaitingCount())
+	})
+
+	t.Run("Should tell the outcomes of TakeMaxDurationContext apart", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 1, WithClock(c), WithInitialTokens(0))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		type outcome struct {
+			ok  bool
+			err error
+		}
+
+		outcomes := make(chan outcome)
+		take := func(ctx context.Context, max time.Duration) {
+			ok, err := b.TakeMaxDurationContext(ctx, 1, max)
+			outcomes <- outcome{ok, err}
+		}
+
+		go take(context.Background(), time.Second*2)
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		c.Advance(time.Second)
+		assert.Equal(outcome{true, nil}, <-outcomes)
+
+		go take(context.Background(), time.Millisecond*500)
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		c.Advance(time.Millisecond * 500)
+		assert.Equal(outcome{false, nil}, <-outcomes)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		go take(ctx, time.Millisecond*500)
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		cancel()
+		assert.Equal(outcome{false, context.Canceled}, <-outcomes)
+		assert.Equal(0, b.WaitingCount())
+		assert.Equal(int64(0), b.Available())
+	})
+
+	t.Run("Should credit the ticks dropped while the daemon is stalled", func(t *testing.T) {
+		c := &stallClock{FakeClock: NewFakeClock(time.Unix(0, 0)), c: make(chan time.Time)}
+		b, err := NewBucket(time.Millisecond*100, 10, WithClock(c), WithInitialTokens(0))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		// Only one tick is received after a stall of 5 intervals.
+		c.Advance(time.Millisecond * 520)
+		c.c <- c.Now()
+		waitUntil(func() bool { return b.Available() > 0 })
+		assert.Equal(int64(5), b.Available())
+
+		c.Advance(time.Millisecond * 80)
+		c.c <- c.Now()
+		waitUntil(func() bool { return b.Available() > 5 })
+		assert.Equal(int64(6), b.Available())
+	})
+
+	t.Run("Should make the bucket full again with Reset", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 3, WithClock(c))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(3))
+
+		small := make(chan struct{})
+		large := make(chan struct{})
+
+		go func() {
+			b.Take(2)
+			close(small)
+		}()
+
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+
+		go func() {
+			b.Take(3)
+			close(large)
+		}()
+
+		waitUntil(func() bool { return b.WaitingCount() == 2 })
+
+		c.Advance(time.Millisecond * 500)
+		b.Reset()
+		<-small
+
+		assert.Equal(int64(1), b.Available())
+		assert.Equal(1, b.WaitingCount())
+
+		c.Advance(time.Millisecond * 500)
+		assert.Equal(int64(1), b.Available())
+
+		c.Advance(time.Millisecond * 500)
+		assert.Equal(int64(2), b.Available())
+
+		b.Reset()
+		<-large
+
+		assert.Equal(int64(0), b.Available())
+		assert.Equal(0, b.WaitingCount())
+
+		b.Reset()
+		assert.Equal(int64(3), b.Available())
+	})
+
+	t.Run("Should estimate the wait for tokens with EstimateWait", func(t *testing.T) {
+		b := New(time.Millisecond*50, 2)
+		defer b.Destroy()
+
+		assert.Equal(time.Duration(0), b.EstimateWait(2))
+		assert.True(b.TryTake(2))
+
+		estimate := b.EstimateWait(2)
+
+		assert.True(estimate > time.Millisecond*50)
+		assert.True(estimate <= time.Millisecond*100)
+		assert.Equal(int64(0), b.Available())
+		assert.Equal(0, b.WaitingCount())
+
+		start := time.Now()
+
+		b.Take(2)
+
+		assert.InDelta(float64(estimate), float64(time.Since(start)), float64(time.Millisecond*20))
+		assert.Panics(func() { b.EstimateWait(3) })
+	})
+
+	t.Run("Should wait until the bucket is full with WaitUntilFull", func(t *testing.T) {
+		b := New(time.Millisecond*20, 2)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(2))
+
+		start := time.Now()
+
+		b.WaitUntilFull()
+
+		assert.True(time.Since(start) >= time.Millisecond*20)
+		assert.Equal(int64(2), b.Available())
+	})
+
+	t.Run("Should give up waiting for a full bucket after max duration", func(t *testing.T) {
+		b := New(time.Minute, 2)
+		defer b.Destroy()
+
+		assert.True(b.WaitUntilFullMaxDuration(time.Millisecond * 10))
+		assert.True(b.TryTake(1))
+		assert.False(b.WaitUntilFullMaxDuration(time.Millisecond * 10))
+		assert.Equal(int64(1), b.Available())
+	})
+
+	t.Run("Should take all available tokens with TakeAll", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(2))
+
+		avail := b.Available()
+
+		assert.Equal(avail, b.TakeAll())
+		assert.Equal(int64(0), b.Availible())
+		assert.Equal(int64(0), b.TakeAll())
+	})
+
+	t.Run("Should take up to max available tokens with TryTakeMaxTokens", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destroy()
+
+		assert.Equal(int64(2), b.TryTakeMaxTokens(2))
+		assert.Equal(int64(3), b.TryTakeMaxTokens(100))
+		assert.Equal(int64(0), b.TryTakeMaxTokens(100))
+		assert.Equal(int64(0), b.Available())
+
+		assert.Panics(func() { b.TryTakeMaxTokens(-1) })
+	})
+
+	t.Run("Should not overflow near math.MaxInt64", func(t *testing.T) {
+		b := New(time.Minute, math.MaxInt64)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(10))
+		b.AddTokens(math.MaxInt64)
+		assert.Equal(int64(math.MaxInt64), b.Available())
+		assert.True(b.TryTake(math.MaxInt64))
+		assert.Equal(int64(0), b.Available())
+
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, math.MaxInt64, WithQuantum(2), WithInitialTokens(0), WithClock(c))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		c.Advance(time.Second)
+		assert.Equal(int64(2), b.Available())
+
+		b, err = NewBucket(time.Nanosecond, math.MaxInt64, WithLazy(), WithInitialTokens(0),
+			WithQuantum(math.MaxInt64/2), WithClock(c))
+		assert.Nil(err)
+
+		c.Advance(time.Nanosecond * 3)
+		assert.Equal(int64(math.MaxInt64), b.Available())
+
+		b = NewEmpty(time.Hour, math.MaxInt64)
+		defer b.Destroy()
+
+		r := b.Reserve(math.MaxInt64)
+		assert.True(r.Delay() > time.Hour*24*365*100)
+	})
+
+	t.Run("Should not overflow refilling a bucket in debt near math.MaxInt64", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, math.MaxInt64, WithInitialTokens(0), WithClock(c))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		b.Reserve(5)
+		assert.Equal(int64(-5), b.Available())
+		assert.Equal(int64(-4), b.AvailableAt(c.Now().Add(time.Second)))
+
+		b.AddTokens(1)
+		assert.Equal(int64(-4), b.Available())
+
+		c.Advance(time.Second)
+		assert.Equal(int64(-3), b.Available())
+
+		b.AddTokens(math.MaxInt64)
+		assert.Equal(int64(math.MaxInt64-3), b.Available())
+
+		b, err = NewBucket(time.Second, math.MaxInt64, WithLazy(), WithInitialTokens(0),
+			WithQuantum(math.MaxInt64/2), WithClock(c))
+		assert.Nil(err)
+
+		b.Reserve(math.MaxInt64)
+		c.Advance(time.Second)
+		assert.Equal(int64(math.MaxInt64/2-math.MaxInt64), b.Available())
+
+		c.Advance(time.Second * 4)
+		assert.Equal(int64(math.MaxInt64), b.Available())
+	})
+
+	t.Run("Should give the clone its own rand", func(t *testing.T) {
+		b, err := NewBucket(time.Millisecond, 1, WithRand(rand.New(rand.NewSource(1))))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		c := b.Clone()
+		defer c.Destroy()
+
+		assert.NotNil(c.rand)
+		assert.True(c.rand != b.rand)
+
+		wg := &sync.WaitGroup{}
+
+		for _, tb := range []*TokenBucket{b, c} {
+			wg.Add(1)
+
+			go func(tb *TokenBucket) {
+				defer wg.Done()
+
+				for i := 0; i < 20; i++ {
+					tb.TakeWithJitter(1, time.Millisecond)
+				}
+			}(tb)
+		}
+
+		wg.Wait()
+	})
+
+	t.Run("Should clone the configuration into an independent bucket", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 10, WithQuantum(5), WithInitialTokens(2))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		c := b.Clone()
+		defer c.Destroy()
+
+		assert.Equal(time.Minute, c.Interval())
+		assert.Equal(int64(10), c.Capability())
+		assert.Equal(b.Rate(), c.Rate())
+		assert.Equal(int64(10), c.Available())
+
+		assert.True(c.TryTake(10))
+		assert.Equal(int64(2), b.Available())
+
+		go c.Take(1)
+
+		time.Sleep(time.Millisecond * 20)
+
+		assert.Equal(1, c.WaitingCount())
+		assert.Equal(0, b.WaitingCount())
+
+		c.Destroy()
+		assert.True(b.TryTake(1))
+	})
+
+	t.Run("Should work as a semaphore when interval is zero", func(t *testing.T) {
+		b := New(0, 3)
+		defer b.Destroy()
+
+		assert.Equal(float64(0), b.Rate())
+		assert.True(b.TryTake(3))
+		assert.False(b.TryTake(1))
+
+		time.Sleep(time.Millisecond * 20)
+
+		assert.Equal(int64(0), b.Available())
+		assert.False(b.TryTake(1))
+
+		done := make(chan struct{})
+
+		go func() {
+			b.Take(2)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+
+		b.Refund(1)
+		assert.Equal(1, b.WaitingCount())
+
+		b.Refund(1)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Take is not served after Refund")
+		}
+
+		b.Refund(1)
+		assert.True(b.TryTake(1))
+		assert.Panics(func() { b.SetInterval(time.Second) })
+	})
+
+	t.Run("Should reject zero interval for a lazy bucket", func(t *testing.T) {
+		assert.Panics(func() { NewLazy(0, 1) })
+
+		_, err := NewBucket(0, 1, WithLazy())
+		assert.EqualError(err, "ratelimit: interval of a lazy bucket should > 0")
+	})
+}
+
+// stallClock is a FakeClock whose ticker only ticks when the test sends to c,
+// so the ticks dropped during a stall can be simulated.
+type stallClock struct {
+	*FakeClock
+	c chan time.Time
+}
+
+func (c *stallClock) NewTicker(d time.Duration) Ticker {
+	return c
+}
+
+func (c *stallClock) C() <-chan time.Time {
+	return c.c
+}
+
+func (c *stallClock) Stop() {}
+
+func (c *stallClock) Reset(d time.Duration) {}
+
+func BenchmarkTakeContended(b *testing.B) {
+	tb := New(time.Microsecond*10, 100)
+	defer tb.Destroy()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tb.Take(1)
+		}
+	})
+}
+
+func BenchmarkTryTake(b *testing.B) {
+	tb := New(time.Minute, int64(b.N)+1)
+	defer tb.Destroy()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tb.TryTake(1)
+	}
+}
+
+func BenchmarkTake(b *testing.B) {
+	tb := New(time.Minute, int64(b.N)+1)
+	defer tb.Destroy()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tb.Take(1)
+	}
+}
+
+func BenchmarkTryTakeContended(b *testing.B) {
+	tb := New(time.Minute, math.MaxInt64)
+	defer tb.Destroy()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tb.TryTake(1)
+		}
+	})
 }
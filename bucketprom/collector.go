@@ -0,0 +1,64 @@
+// Package bucketprom exports the state of token buckets as prometheus
+// metrics, it is kept apart so the bucket package has no dependencies.
+package bucketprom
+
+import (
+	bucket "github.com/DavidCai1993/token-bucket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type collector struct {
+	tb        *bucket.TokenBucket
+	capacity  *prometheus.Desc
+	available *prometheus.Desc
+	waiting   *prometheus.Desc
+	taken     *prometheus.Desc
+	timeouts  *prometheus.Desc
+}
+
+// NewCollector returns a prometheus.Collector exporting the state of tb as
+// metrics prefixed by name:
+//
+//	<name>_capacity          gauge of the capability of the bucket
+//	<name>_available_tokens  gauge of the available tokens
+//	<name>_waiting           gauge of the waiting jobs
+//	<name>_taken_total       counter of the tokens taken
+//	<name>_timeouts_total    counter of the waits timed out or cancelled
+func NewCollector(name string, tb *bucket.TokenBucket) prometheus.Collector {
+	return &collector{
+		tb: tb,
+		capacity: prometheus.NewDesc(name+"_capacity",
+			"Capability of the token bucket.", nil, nil),
+		available: prometheus.NewDesc(name+"_available_tokens",
+			"Tokens available in the token bucket.", nil, nil),
+		waiting: prometheus.NewDesc(name+"_waiting",
+			"Jobs waiting for tokens.", nil, nil),
+		taken: prometheus.NewDesc(name+"_taken_total",
+			"Total tokens taken from the token bucket.", nil, nil),
+		timeouts: prometheus.NewDesc(name+"_timeouts_total",
+			"Total waits for tokens timed out or cancelled.", nil, nil),
+	}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.capacity
+	ch <- c.available
+	ch <- c.waiting
+	ch <- c.taken
+	ch <- c.timeouts
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.tb.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue,
+		float64(c.tb.Capability()))
+	ch <- prometheus.MustNewConstMetric(c.available, prometheus.GaugeValue,
+		float64(c.tb.Available()))
+	ch <- prometheus.MustNewConstMetric(c.waiting, prometheus.GaugeValue,
+		float64(stats.Waiting))
+	ch <- prometheus.MustNewConstMetric(c.taken, prometheus.CounterValue,
+		float64(stats.Taken))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue,
+		float64(stats.Timeouts))
+}
@@ -0,0 +1,43 @@
+package bucketprom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	bucket "github.com/DavidCai1993/token-bucket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should export the state of the bucket", func(t *testing.T) {
+		b := bucket.New(time.Minute, 10)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(7))
+		assert.False(b.TakeMaxDuration(5, time.Millisecond*10))
+
+		expected := `
+# HELP limiter_available_tokens Tokens available in the token bucket.
+# TYPE limiter_available_tokens gauge
+limiter_available_tokens 3
+# HELP limiter_capacity Capability of the token bucket.
+# TYPE limiter_capacity gauge
+limiter_capacity 10
+# HELP limiter_taken_total Total tokens taken from the token bucket.
+# TYPE limiter_taken_total counter
+limiter_taken_total 7
+# HELP limiter_timeouts_total Total waits for tokens timed out or cancelled.
+# TYPE limiter_timeouts_total counter
+limiter_timeouts_total 1
+# HELP limiter_waiting Jobs waiting for tokens.
+# TYPE limiter_waiting gauge
+limiter_waiting 0
+`
+
+		assert.Nil(testutil.CollectAndCompare(NewCollector("limiter", b), strings.NewReader(expected)))
+	})
+}
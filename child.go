@@ -0,0 +1,33 @@
+package bucket
+
+import (
+	"fmt"
+	"time"
+)
+
+// NewChild returns a new token bucket with specified fill interval and
+// capability whose takes also take the same tokens from parent, e.g. to
+// enforce a global limit on top of per-tenant ones. A take only succeeds when
+// both the child and the parent have enough tokens, and the parent is left
+// untouched if the child has not. Waiters of the child check the parent again
+// on every refill of the child, they are not queued in the parent. Refund and
+// Reservation.Cancel give the tokens back to both buckets. It panics if cap is
+// greater than the capability of parent, as such takes could never fit in the
+// parent.
+func NewChild(parent *TokenBucket, interval time.Duration, cap int64) *TokenBucket {
+	if pc := parent.Capability(); cap > pc {
+		panic(fmt.Sprintf("ratelimit: capability %v should not be greater than"+
+			" parent's capability %v", cap, pc))
+	}
+
+	tb, err := newTokenBucket(interval, cap)
+
+	if err != nil {
+		panic(err.Error())
+	}
+
+	tb.parent = parent
+	tb.start()
+
+	return tb
+}
@@ -0,0 +1,113 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChildTokenBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should enforce the parent limit across children", func(t *testing.T) {
+		parent := New(time.Minute, 3)
+		defer parent.Destroy()
+
+		a := NewChild(parent, time.Minute, 2)
+		defer a.Destroy()
+
+		b := NewChild(parent, time.Minute, 2)
+		defer b.Destroy()
+
+		assert.True(a.TryTake(2))
+		assert.False(a.TryTake(1))
+		assert.True(b.TryTake(1))
+		assert.False(b.TryTake(1))
+
+		assert.Equal(int64(0), parent.Available())
+		assert.Equal(int64(0), a.Available())
+		assert.Equal(int64(1), b.Available())
+	})
+
+	t.Run("Should not take from the parent when the child has no tokens", func(t *testing.T) {
+		parent := New(time.Minute, 5)
+		defer parent.Destroy()
+
+		c := NewChild(parent, time.Minute, 1)
+		defer c.Destroy()
+
+		assert.True(c.TryTake(1))
+		assert.False(c.TryTake(1))
+		assert.Equal(int64(0), c.TryTakeN(1))
+		assert.Equal(int64(4), parent.Available())
+	})
+
+	t.Run("Should take partially from both with TryTakeN", func(t *testing.T) {
+		parent, err := NewBucket(time.Minute, 5, WithInitialTokens(2))
+		assert.Nil(err)
+		defer parent.Destroy()
+
+		c := NewChild(parent, time.Minute, 5)
+		defer c.Destroy()
+
+		assert.Equal(int64(2), c.TryTakeN(4))
+		assert.Equal(int64(3), c.Available())
+		assert.Equal(int64(0), parent.Available())
+	})
+
+	t.Run("Should wait for the parent to be refilled", func(t *testing.T) {
+		parent, err := NewBucket(time.Minute, 2, WithInitialTokens(1))
+		assert.Nil(err)
+		defer parent.Destroy()
+
+		c := NewChild(parent, time.Millisecond*20, 2)
+		defer c.Destroy()
+
+		assert.True(c.TryTake(1))
+		assert.False(c.TakeMaxDuration(1, time.Millisecond*50))
+
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			parent.AddTokens(1)
+		}()
+
+		assert.True(c.TakeMaxDuration(1, time.Second))
+		assert.Equal(int64(0), parent.Available())
+	})
+
+	t.Run("Should refund both the child and the parent", func(t *testing.T) {
+		parent := New(time.Minute, 2)
+		defer parent.Destroy()
+
+		c := NewChild(parent, time.Minute, 2)
+		defer c.Destroy()
+
+		assert.True(c.TryTake(2))
+
+		c.Refund(1)
+		assert.Equal(int64(1), c.Available())
+		assert.Equal(int64(1), parent.Available())
+
+		r := c.Reserve(1)
+		assert.Equal(int64(0), parent.Available())
+
+		r.Cancel()
+		assert.Equal(int64(1), c.Available())
+		assert.Equal(int64(1), parent.Available())
+	})
+
+	t.Run("Should panic when the capability is greater than the parent's", func(t *testing.T) {
+		parent := New(time.Minute, 2)
+		defer parent.Destroy()
+
+		assert.PanicsWithValue("ratelimit: capability 5 should not be greater"+
+			" than parent's capability 2", func() { NewChild(parent, time.Minute, 5) })
+
+		c := NewChild(parent, time.Minute, 2)
+		defer c.Destroy()
+
+		assert.Panics(func() { c.TryTake(3) })
+		assert.Equal(int64(2), parent.Available())
+	})
+}
@@ -0,0 +1,91 @@
+package bucket
+
+import "time"
+
+// Clock is the source of time of a token bucket, it can be replaced by
+// WithClock to control the time in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTicker returns a new Ticker which ticks every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks like time.Ticker.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+	// Stop turns off the ticker.
+	Stop()
+	// Reset stops the ticker and resets its period to d.
+	Reset(d time.Duration)
+}
+
+// Timer fires once like time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, it returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+}
+
+// TimerClock is a Clock which also creates the timers of the bucket, e.g. for
+// the timeouts of TakeMaxDuration and the sleeps of lazy buckets. The timers of
+// a bucket with a Clock which is not a TimerClock come from the time package.
+type TimerClock interface {
+	Clock
+	// NewTimer returns a new Timer which fires after d.
+	NewTimer(d time.Duration) Timer
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{ticker: time.NewTicker(d)}
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{timer: time.NewTimer(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+func (t realTicker) Reset(d time.Duration) {
+	t.ticker.Reset(d)
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// newTimer returns a new Timer from the clock of the bucket.
+func (tb *TokenBucket) newTimer(d time.Duration) Timer {
+	if c, ok := tb.clock.(TimerClock); ok {
+		return c.NewTimer(d)
+	}
+
+	return realClock{}.NewTimer(d)
+}
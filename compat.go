@@ -0,0 +1,43 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// The methods in this file mirror golang.org/x/time/rate.Limiter, so code
+// using it can switch to a token bucket with minimal changes.
+
+// Allow is shorthand for AllowN(now, 1), where now is from the clock of the
+// bucket.
+func (tb *TokenBucket) Allow() bool {
+	return tb.AllowN(tb.clock.Now(), 1)
+}
+
+// AllowN reports whether n tokens can be taken now and takes them if so, like
+// TryTake. Unlike TryTake it returns false instead of panicking when n exceeds
+// the capability of the bucket. now is only for compatibility, the bucket
+// always uses its own clock.
+func (tb *TokenBucket) AllowN(now time.Time, n int) bool {
+	if n < 0 || int64(n) > tb.Capability() {
+		return false
+	}
+
+	return tb.TryTake(int64(n))
+}
+
+// WaitN takes n tokens like TakeContext. Unlike TakeContext it returns an
+// error instead of panicking when n is negative or exceeds the capability of
+// the bucket.
+func (tb *TokenBucket) WaitN(ctx context.Context, n int) error {
+	if n < 0 {
+		return fmt.Errorf("token-bucket: WaitN(n=%d) should not be negative", n)
+	}
+
+	if cap := tb.Capability(); int64(n) > cap {
+		return fmt.Errorf("token-bucket: WaitN(n=%d) exceeds bucket's capability %d", n, cap)
+	}
+
+	return tb.TakeContext(ctx, int64(n))
+}
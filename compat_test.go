@@ -0,0 +1,56 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompat(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should allow like TryTake", func(t *testing.T) {
+		a := New(time.Minute, 2)
+		defer a.Destroy()
+
+		b := New(time.Minute, 2)
+		defer b.Destroy()
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(a.TryTake(1), b.Allow())
+		}
+
+		assert.Equal(a.Available(), b.Available())
+	})
+
+	t.Run("Should allow n tokens like TryTake", func(t *testing.T) {
+		b := New(time.Minute, 3)
+		defer b.Destroy()
+
+		assert.True(b.AllowN(time.Now(), 2))
+		assert.False(b.AllowN(time.Now(), 2))
+		assert.True(b.AllowN(time.Now(), 1))
+		assert.False(b.AllowN(time.Now(), 4))
+		assert.Equal(int64(0), b.Available())
+	})
+
+	t.Run("Should wait n tokens like TakeContext", func(t *testing.T) {
+		b := New(time.Millisecond*50, 2)
+		defer b.Destroy()
+
+		assert.Nil(b.WaitN(context.Background(), 2))
+		assert.Nil(b.WaitN(context.Background(), 1))
+		assert.Equal(int64(0), b.Available())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+
+		assert.Equal(context.DeadlineExceeded, b.WaitN(ctx, 2))
+		assert.EqualError(b.WaitN(context.Background(), 3),
+			"token-bucket: WaitN(n=3) exceeds bucket's capability 2")
+		assert.EqualError(b.WaitN(context.Background(), -1),
+			"token-bucket: WaitN(n=-1) should not be negative")
+	})
+}
@@ -0,0 +1,93 @@
+package bucket
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of a token bucket which can be written as a
+// single string like "1000/1s", i.e. cap tokens every interval, or like
+// "1000/1s/10" to refill quantum tokens every interval, e.g. in YAML, TOML or
+// environment variables. A zero Quantum means 1.
+type Config struct {
+	Interval time.Duration
+	Cap      int64
+	Quantum  int64
+}
+
+// FromConfig returns a new token bucket created with config, see NewBucket.
+// It panics if config is invalid.
+func FromConfig(config Config) *TokenBucket {
+	var opts []Option
+
+	if config.Quantum != 0 {
+		opts = append(opts, WithQuantum(config.Quantum))
+	}
+
+	tb, err := NewBucket(config.Interval, config.Cap, opts...)
+
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return tb
+}
+
+// String returns the config in the form accepted by UnmarshalText.
+func (c Config) String() string {
+	if c.Quantum == 0 || c.Quantum == 1 {
+		return fmt.Sprintf("%d/%v", c.Cap, c.Interval)
+	}
+
+	return fmt.Sprintf("%d/%v/%d", c.Cap, c.Interval, c.Quantum)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Config) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, text should be like
+// "1000/1s" or "1000/1s/10", the interval is parsed by time.ParseDuration.
+func (c *Config) UnmarshalText(text []byte) error {
+	parts := strings.Split(string(text), "/")
+
+	if len(parts) != 2 && len(parts) != 3 {
+		return fmt.Errorf("token-bucket: invalid config %q: should be like"+
+			" \"cap/interval\" or \"cap/interval/quantum\"", text)
+	}
+
+	cap, err := strconv.ParseInt(parts[0], 10, 64)
+
+	if err != nil {
+		return fmt.Errorf("token-bucket: invalid cap in config %q: %v", text, err)
+	}
+
+	interval, err := time.ParseDuration(parts[1])
+
+	if err != nil {
+		return fmt.Errorf("token-bucket: invalid interval in config %q: %v", text, err)
+	}
+
+	if err := checkArgs(interval, cap); err != nil {
+		return err
+	}
+
+	var quantum int64 = 1
+
+	if len(parts) == 3 {
+		if quantum, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+			return fmt.Errorf("token-bucket: invalid quantum in config %q: %v", text, err)
+		}
+
+		if quantum <= 0 {
+			return fmt.Errorf("ratelimit: quantum %v should > 0", quantum)
+		}
+	}
+
+	*c = Config{Interval: interval, Cap: cap, Quantum: quantum}
+
+	return nil
+}
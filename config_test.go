@@ -0,0 +1,67 @@
+package bucket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should parse the config strings", func(t *testing.T) {
+		var c Config
+
+		assert.Nil(c.UnmarshalText([]byte("1000/1s")))
+		assert.Equal(Config{Interval: time.Second, Cap: 1000, Quantum: 1}, c)
+
+		assert.Nil(c.UnmarshalText([]byte("10/100ms/5")))
+		assert.Equal(Config{Interval: time.Millisecond * 100, Cap: 10, Quantum: 5}, c)
+	})
+
+	t.Run("Should reject invalid config strings", func(t *testing.T) {
+		var c Config
+
+		for _, text := range []string{"", "1000", "1000/1s/1/1", "x/1s", "1000/x",
+			"1000/1s/x", "1000/1s/0", "-1/1s", "1000/-1s"} {
+			assert.NotNil(c.UnmarshalText([]byte(text)), text)
+		}
+
+		assert.Equal(Config{}, c)
+	})
+
+	t.Run("Should marshal the config to text", func(t *testing.T) {
+		text, err := Config{Interval: time.Second, Cap: 1000}.MarshalText()
+		assert.Nil(err)
+		assert.Equal("1000/1s", string(text))
+
+		c := Config{Interval: time.Minute, Cap: 10, Quantum: 2}
+		assert.Equal("10/1m0s/2", c.String())
+
+		data, err := json.Marshal(map[string]Config{"limit": c})
+		assert.Nil(err)
+		assert.Equal(`{"limit":"10/1m0s/2"}`, string(data))
+
+		var v map[string]Config
+
+		assert.Nil(json.Unmarshal(data, &v))
+		assert.Equal(c, v["limit"])
+	})
+
+	t.Run("Should create a bucket from the config", func(t *testing.T) {
+		var c Config
+
+		assert.Nil(c.UnmarshalText([]byte("10/1m/5")))
+
+		b := FromConfig(c)
+		defer b.Destroy()
+
+		assert.Equal(time.Minute, b.Interval())
+		assert.Equal(int64(10), b.Capability())
+		assert.Equal(float64(5)/60, b.Rate())
+
+		assert.Panics(func() { FromConfig(Config{Interval: time.Second, Cap: -1}) })
+	})
+}
@@ -0,0 +1,91 @@
+package bucket
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type conn struct {
+	net.Conn
+	r             *reader
+	w             *writer
+	mutex         *sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// NewConn returns a net.Conn which reads from c like NewReader with read and
+// writes to c like NewWriter with write, one token per byte, e.g. to simulate
+// a slow network. A nil bucket leaves that direction unlimited. The deadlines
+// set on the returned conn also bound the waits for tokens, a Read or Write
+// waiting past its deadline returns os.ErrDeadlineExceeded, which is a timeout
+// net.Error. A deadline changed during a wait for tokens only applies to the
+// next one.
+func NewConn(c net.Conn, read, write *TokenBucket) net.Conn {
+	tc := &conn{Conn: c, mutex: &sync.Mutex{}}
+
+	if read != nil {
+		tc.r = &reader{r: c, tb: read, deadline: tc.getReadDeadline}
+	}
+
+	if write != nil {
+		tc.w = &writer{w: c, tb: write, deadline: tc.getWriteDeadline}
+	}
+
+	return tc
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	if c.r == nil {
+		return c.Conn.Read(p)
+	}
+
+	return c.r.Read(p)
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	if c.w == nil {
+		return c.Conn.Write(p)
+	}
+
+	return c.w.Write(p)
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mutex.Unlock()
+
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.readDeadline = t
+	c.mutex.Unlock()
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.mutex.Lock()
+	c.writeDeadline = t
+	c.mutex.Unlock()
+
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *conn) getReadDeadline() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.readDeadline
+}
+
+func (c *conn) getWriteDeadline() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.writeDeadline
+}
@@ -0,0 +1,73 @@
+package bucket
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should transfer at the fill rate of the buckets", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		write := NewEmpty(time.Millisecond*10, 10)
+		defer write.Destroy()
+
+		read := NewEmpty(time.Millisecond*10, 10)
+		defer read.Destroy()
+
+		c := NewConn(client, nil, write)
+		s := NewConn(server, read, nil)
+		data := bytes.Repeat([]byte("a"), 30)
+		start := time.Now()
+
+		go c.Write(data)
+
+		buf := make([]byte, len(data))
+		n, err := io.ReadFull(s, buf)
+
+		assert.Nil(err)
+		assert.Equal(30, n)
+		assert.Equal(data, buf)
+		assert.True(time.Since(start) >= time.Millisecond*250)
+		assert.True(time.Since(start) < time.Millisecond*600)
+	})
+
+	t.Run("Should give up waiting for tokens at the deadline", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		write := NewEmpty(time.Minute, 10)
+		defer write.Destroy()
+
+		c := NewConn(client, nil, write)
+
+		assert.Nil(c.SetWriteDeadline(time.Now().Add(time.Millisecond * 20)))
+
+		n, err := c.Write([]byte("a"))
+
+		assert.Equal(0, n)
+		assert.Equal(os.ErrDeadlineExceeded, err)
+		assert.True(err.(net.Error).Timeout())
+
+		assert.Nil(c.SetDeadline(time.Time{}))
+		write.AddTokens(1)
+
+		go io.ReadFull(server, make([]byte, 1))
+
+		n, err = c.Write([]byte("a"))
+
+		assert.Nil(err)
+		assert.Equal(1, n)
+	})
+}
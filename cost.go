@@ -0,0 +1,20 @@
+package bucket
+
+// Cost is how many tokens an operation costs, which makes the call sites
+// read like tb.TakeCost(bucket.Bytes(4096)).
+type Cost int64
+
+// Bytes returns the cost of transferring n bytes, one token per byte.
+func Bytes(n int) Cost {
+	return Cost(n)
+}
+
+// Requests returns the cost of n requests, one token per request.
+func Requests(n int) Cost {
+	return Cost(n)
+}
+
+// TakeCost takes the tokens of cost from the bucket like Take.
+func (tb *TokenBucket) TakeCost(cost Cost) {
+	tb.Take(int64(cost))
+}
@@ -0,0 +1,22 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCost(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should take the tokens of the cost", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destroy()
+
+		b.TakeCost(Bytes(4))
+		b.TakeCost(Requests(1))
+
+		assert.Equal(int64(5), b.Available())
+	})
+}
@@ -0,0 +1,226 @@
+// Package distbucket provides token buckets shared by multiple processes, it
+// is kept apart so the bucket package has no dependencies.
+package distbucket
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	bucket "github.com/DavidCai1993/token-bucket"
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes the tokens atomically in redis, the time is
+// read from the redis server so the clocks of the clients do not matter. It
+// returns whether the tokens are taken and otherwise how many microseconds to
+// wait until they are refilled. The key expires once the bucket would be full
+// again, which is the same as a new bucket.
+var takeScript = redis.NewScript(`
+local cap = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local count = tonumber(ARGV[3])
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local state = redis.call("HMGET", KEYS[1], "avail", "last")
+local avail = tonumber(state[1])
+local last = tonumber(state[2])
+
+if avail == nil or last == nil then
+	avail = cap
+	last = now
+end
+
+local ticks = math.floor((now - last) / interval)
+
+if ticks > 0 then
+	avail = math.min(cap, avail + ticks)
+	last = last + ticks * interval
+end
+
+local ok = 0
+local wait = 0
+
+if count <= avail then
+	avail = avail - count
+	ok = 1
+else
+	wait = last + (count - avail) * interval - now
+end
+
+redis.call("HSET", KEYS[1], "avail", avail, "last", last)
+redis.call("PEXPIRE", KEYS[1], math.max(1, math.ceil((cap - avail) * interval / 1000)))
+
+return {ok, wait}
+`)
+
+// availScript returns how many tokens are available after the refills since
+// the last take, without changing the bucket.
+var availScript = redis.NewScript(`
+local cap = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local state = redis.call("HMGET", KEYS[1], "avail", "last")
+local avail = tonumber(state[1])
+local last = tonumber(state[2])
+
+if avail == nil or last == nil then
+	return cap
+end
+
+local ticks = math.floor((now - last) / interval)
+
+if ticks > 0 then
+	avail = math.min(cap, avail + ticks)
+end
+
+return avail
+`)
+
+var _ bucket.Limiter = (*RedisBucket)(nil)
+
+// RedisBucket is a token bucket whose state is kept in redis, so all the
+// RedisBuckets using the same key share the same tokens. One token is
+// refilled every interval like the buckets returned by bucket.New. It is a
+// bucket.Limiter, so it can be used with the io and http wrappers of bucket.
+type RedisBucket struct {
+	client   redis.UniversalClient
+	key      string
+	interval time.Duration
+	cap      int64
+}
+
+// NewRedis returns a new token bucket stored at key in redis with specified
+// fill interval and capability. It panics if the interval is less than one
+// microsecond or the capability is negative. All the buckets sharing a key
+// should use the same interval and capability.
+func NewRedis(client redis.UniversalClient, key string, interval time.Duration, cap int64) *RedisBucket {
+	if interval < time.Microsecond {
+		panic(fmt.Sprintf("ratelimit: interval %v should >= 1µs", interval))
+	}
+
+	if cap < 0 {
+		panic(fmt.Sprintf("ratelimit: capability %v should > 0", cap))
+	}
+
+	return &RedisBucket{
+		client:   client,
+		key:      key,
+		interval: interval,
+		cap:      cap,
+	}
+}
+
+// Capability returns the capability of this token bucket.
+func (b *RedisBucket) Capability() int64 {
+	return b.cap
+}
+
+// Available returns how many tokens are available in the bucket, or zero if
+// redis fails.
+func (b *RedisBucket) Available() int64 {
+	avail, err := b.AvailableContext(context.Background())
+
+	if err != nil {
+		return 0
+	}
+
+	return avail
+}
+
+// AvailableContext works like Available, but returns the error of redis.
+func (b *RedisBucket) AvailableContext(ctx context.Context) (int64, error) {
+	return availScript.Run(ctx, b.client, []string{b.key},
+		b.cap, b.interval.Microseconds()).Int64()
+}
+
+// TryTake trys to take specified count tokens from the bucket. If there are
+// not enough tokens in the bucket or redis fails, it will return false.
+func (b *RedisBucket) TryTake(count int64) bool {
+	ok, _, err := b.take(context.Background(), count)
+
+	return err == nil && ok
+}
+
+// TryTakeContext works like TryTake, but returns the error of redis.
+func (b *RedisBucket) TryTakeContext(ctx context.Context, count int64) (bool, error) {
+	ok, _, err := b.take(ctx, count)
+
+	return ok, err
+}
+
+// Take takes specified count tokens from the bucket, if there are not enough
+// tokens in the bucket, it will keep waiting until count tokens are available
+// and then take them. It returns without taking tokens if redis fails, use
+// TakeContext to get the error.
+func (b *RedisBucket) Take(count int64) {
+	b.TakeContext(context.Background(), count)
+}
+
+// TakeContext works like Take, but returns ctx.Err() when the context is
+// cancelled or its deadline passes while waiting, or the error of redis.
+func (b *RedisBucket) TakeContext(ctx context.Context, count int64) error {
+	for {
+		ok, wait, err := b.take(ctx, count)
+
+		if err != nil || ok {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		}
+	}
+}
+
+// TakeMaxDuration takes specified count tokens like Take, but gives up and
+// returns false without taking tokens if they can not be taken within max or
+// redis fails.
+func (b *RedisBucket) TakeMaxDuration(count int64, max time.Duration) bool {
+	deadline := time.Now().Add(max)
+
+	for {
+		ok, wait, err := b.take(context.Background(), count)
+
+		if err != nil {
+			return false
+		}
+
+		if ok {
+			return true
+		}
+
+		if time.Now().Add(wait).After(deadline) {
+			return false
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+func (b *RedisBucket) take(ctx context.Context, count int64) (bool, time.Duration, error) {
+	if count < 0 || count > b.cap {
+		panic(fmt.Sprintf("token-bucket: count %v should be less than bucket's"+
+			" capablity %v", count, b.cap))
+	}
+
+	res, err := takeScript.Run(ctx, b.client, []string{b.key},
+		b.cap, b.interval.Microseconds(), count).Int64Slice()
+
+	if err != nil {
+		return false, 0, err
+	}
+
+	return res[0] == 1, time.Duration(res[1]) * time.Microsecond, nil
+}
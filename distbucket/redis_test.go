@@ -0,0 +1,119 @@
+package distbucket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	newClient := func(m *miniredis.Miniredis) *redis.Client {
+		client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+		t.Cleanup(func() { client.Close() })
+
+		return client
+	}
+
+	t.Run("Should take tokens and refill them by the redis time", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		now := time.Now()
+		m.SetTime(now)
+
+		b := NewRedis(newClient(m), "limiter", time.Second, 2)
+
+		assert.True(b.TryTake(2))
+		assert.False(b.TryTake(1))
+
+		m.SetTime(now.Add(time.Second))
+		assert.True(b.TryTake(1))
+		assert.False(b.TryTake(1))
+
+		m.SetTime(now.Add(time.Minute))
+		assert.True(b.TryTake(2))
+	})
+
+	t.Run("Should share the tokens between clients", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		m.SetTime(time.Now())
+
+		a := NewRedis(newClient(m), "limiter", time.Second, 3)
+		b := NewRedis(newClient(m), "limiter", time.Second, 3)
+		c := NewRedis(newClient(m), "other", time.Second, 3)
+
+		assert.True(a.TryTake(2))
+		assert.False(b.TryTake(2))
+		assert.True(b.TryTake(1))
+		assert.False(a.TryTake(1))
+		assert.True(c.TryTake(3))
+	})
+
+	t.Run("Should wait until the tokens are refilled", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		b := NewRedis(newClient(m), "limiter", time.Millisecond*50, 1)
+
+		b.Take(1)
+
+		start := time.Now()
+		assert.Nil(b.TakeContext(context.Background(), 1))
+		assert.True(time.Since(start) >= time.Millisecond*40)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+
+		assert.Equal(context.DeadlineExceeded, b.TakeContext(ctx, 1))
+	})
+
+	t.Run("Should report the available tokens", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		now := time.Now()
+		m.SetTime(now)
+
+		b := NewRedis(newClient(m), "limiter", time.Second, 3)
+
+		assert.Equal(int64(3), b.Available())
+		assert.True(b.TryTake(3))
+		assert.Equal(int64(0), b.Available())
+
+		m.SetTime(now.Add(time.Second * 2))
+		assert.Equal(int64(2), b.Available())
+
+		m.SetTime(now.Add(time.Minute))
+		assert.Equal(int64(3), b.Available())
+	})
+
+	t.Run("Should give up waiting after the max duration", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		b := NewRedis(newClient(m), "limiter", time.Millisecond*50, 1)
+
+		assert.True(b.TakeMaxDuration(1, 0))
+		assert.False(b.TakeMaxDuration(1, time.Millisecond*10))
+
+		start := time.Now()
+		assert.True(b.TakeMaxDuration(1, time.Second))
+		assert.True(time.Since(start) >= time.Millisecond*30)
+	})
+
+	t.Run("Should return the error of redis", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		b := NewRedis(newClient(m), "limiter", time.Second, 1)
+
+		m.Close()
+
+		assert.False(b.TryTake(1))
+		assert.False(b.TakeMaxDuration(1, time.Second))
+		assert.Equal(int64(0), b.Available())
+
+		_, err := b.TryTakeContext(context.Background(), 1)
+		assert.NotNil(err)
+		assert.NotNil(b.TakeContext(context.Background(), 1))
+
+		_, err = b.AvailableContext(context.Background())
+		assert.NotNil(err)
+	})
+}
@@ -23,3 +23,14 @@ func Example() {
 
 	tb.Wait(1000)
 }
+
+func ExampleTokenBucket_TakeCost() {
+	tb := bucket.New(time.Millisecond, 8192)
+	defer tb.Destroy()
+
+	tb.TakeCost(bucket.Bytes(4096))
+	tb.TakeCost(bucket.Requests(1))
+
+	fmt.Println(tb.Available() < 8192)
+	// Output: true
+}
@@ -0,0 +1,20 @@
+package bucket
+
+import "expvar"
+
+// PublishExpvar publishes the capability, available tokens and waiting jobs
+// of tb as a JSON object named name through expvar, so it shows up at
+// /debug/vars. Like expvar.Publish, it panics if name is already registered.
+func PublishExpvar(name string, tb *TokenBucket) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return struct {
+			Cap     int64 `json:"cap"`
+			Avail   int64 `json:"avail"`
+			Waiting int   `json:"waiting"`
+		}{
+			Cap:     tb.Capability(),
+			Avail:   tb.Available(),
+			Waiting: tb.Stats().Waiting,
+		}
+	}))
+}
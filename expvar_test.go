@@ -0,0 +1,31 @@
+package bucket
+
+import (
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// expvarRuns makes the published names unique, as expvar can not unpublish
+// them when the tests run more than once.
+var expvarRuns int64
+
+func TestPublishExpvar(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should publish the state of the bucket", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destroy()
+
+		name := fmt.Sprintf("token-bucket-test-%d", atomic.AddInt64(&expvarRuns, 1))
+		PublishExpvar(name, b)
+
+		assert.True(b.TryTake(4))
+		assert.Equal(`{"cap":10,"avail":6,"waiting":0}`, expvar.Get(name).String())
+		assert.Panics(func() { PublishExpvar(name, b) })
+	})
+}
@@ -0,0 +1,324 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// fairRetryInterval is how long the dispatcher of a FairKeyedBucket waits
+// before taking from a parent whose waiting queue was full again.
+const fairRetryInterval = time.Millisecond * 10
+
+// FairKeyedBucket is a KeyedBucket whose keys also share the tokens of a
+// parent bucket, e.g. a global limit over per-tenant ones. Unlike children
+// created by NewChild, which race for the tokens of the parent, the waiters
+// of all the keys are served round-robin by the key, so a key with many
+// waiters can not starve the others and every key with pending waiters gets
+// an equal share of the parent, or a share proportional to its weight. It is
+// safe to use under concurrency environments.
+type FairKeyedBucket struct {
+	parent      *TokenBucket
+	keyed       *KeyedBucket
+	mutex       *sync.Mutex
+	queues      map[string][]*fairWaiter
+	weights     map[string]int
+	keys        []string
+	cursor      int
+	served      int
+	wake        chan struct{}
+	done        chan struct{}
+	destroyOnce *sync.Once
+}
+
+type fairWaiter struct {
+	key     string
+	count   int64
+	ready   chan struct{}
+	granted bool
+}
+
+// NewFairKeyed returns a new FairKeyedBucket whose buckets are created like
+// NewKeyed and which shares the tokens of parent fairly. parent is not
+// destroyed with the FairKeyedBucket, and should not be taken from elsewhere
+// for the fairness to hold.
+func NewFairKeyed(parent *TokenBucket, interval time.Duration, cap int64, ttl time.Duration) *FairKeyedBucket {
+	fb := &FairKeyedBucket{
+		parent:      parent,
+		keyed:       NewKeyed(interval, cap, ttl),
+		mutex:       &sync.Mutex{},
+		queues:      make(map[string][]*fairWaiter),
+		weights:     make(map[string]int),
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		destroyOnce: &sync.Once{},
+	}
+
+	go fb.dispatchDaemon()
+
+	return fb
+}
+
+// SetWeight makes key get weight grants of the parent in each round instead
+// of one. It panics if weight is not positive.
+func (fb *FairKeyedBucket) SetWeight(key string, weight int) {
+	if weight <= 0 {
+		panic(fmt.Sprintf("ratelimit: weight %v should > 0", weight))
+	}
+
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+
+	fb.weights[key] = weight
+}
+
+// Take takes specified count tokens from the bucket of key and then from the
+// parent in its turn, waiting until both are available. It returns early
+// without taking tokens if the FairKeyedBucket or the parent is destroyed.
+func (fb *FairKeyedBucket) Take(key string, count int64) {
+	fb.TakeContext(context.Background(), key, count)
+}
+
+// TakeContext works like Take but just returns ctx.Err() without taking
+// tokens when the context is cancelled or its deadline passes.
+// ErrBucketDestroyed is returned if the FairKeyedBucket or the parent is
+// destroyed while waiting.
+func (fb *FairKeyedBucket) TakeContext(ctx context.Context, key string, count int64) error {
+	if cap := fb.parent.Capability(); count > cap {
+		panic(fmt.Sprintf("token-bucket: count %v should be less than parent's"+
+			" capablity %v", count, cap))
+	}
+
+	tb := fb.keyed.Get(key)
+
+	if err := tb.TakeContext(ctx, count); err != nil {
+		return err
+	}
+
+	w := &fairWaiter{key: key, count: count, ready: make(chan struct{}, 1)}
+
+	if !fb.enqueue(w) {
+		tb.Refund(count)
+
+		return ErrBucketDestroyed
+	}
+
+	var err error
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-fb.done:
+		err = ErrBucketDestroyed
+	}
+
+	fb.mutex.Lock()
+
+	if w.granted {
+		fb.mutex.Unlock()
+
+		return nil
+	}
+
+	fb.remove(w)
+	fb.mutex.Unlock()
+
+	tb.Refund(count)
+
+	return err
+}
+
+// Destroy destroys the buckets of the keys and stops the inner goroutine,
+// the waiters are released without taking tokens. It is safe to call Destroy
+// more than once.
+func (fb *FairKeyedBucket) Destroy() {
+	fb.destroyOnce.Do(func() {
+		close(fb.done)
+		fb.keyed.Destroy()
+	})
+}
+
+// enqueue adds w to the queue of its key, it returns false if fb is
+// destroyed.
+func (fb *FairKeyedBucket) enqueue(w *fairWaiter) bool {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+
+	select {
+	case <-fb.done:
+		return false
+	default:
+	}
+
+	if len(fb.queues[w.key]) == 0 {
+		// The key joins the round right before the key in turn, so it is
+		// served after all the keys already waiting.
+		if fb.cursor > len(fb.keys) {
+			fb.cursor = len(fb.keys)
+		}
+
+		fb.keys = append(fb.keys, "")
+		copy(fb.keys[fb.cursor+1:], fb.keys[fb.cursor:])
+		fb.keys[fb.cursor] = w.key
+		fb.cursor++
+	}
+
+	fb.queues[w.key] = append(fb.queues[w.key], w)
+
+	select {
+	case fb.wake <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// remove removes w from the queue of its key, it should be called with mutex
+// held.
+func (fb *FairKeyedBucket) remove(w *fairWaiter) {
+	queue := fb.queues[w.key]
+
+	for i, qw := range queue {
+		if qw == w {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+
+	if len(queue) > 0 {
+		fb.queues[w.key] = queue
+		return
+	}
+
+	delete(fb.queues, w.key)
+
+	for i, key := range fb.keys {
+		if key != w.key {
+			continue
+		}
+
+		fb.keys = append(fb.keys[:i], fb.keys[i+1:]...)
+
+		if i < fb.cursor {
+			fb.cursor--
+		} else if i == fb.cursor {
+			fb.served = 0
+		}
+
+		break
+	}
+}
+
+// front returns the first waiter of the key in turn, or nil if there is no
+// waiter. It should be called with mutex held.
+func (fb *FairKeyedBucket) front() *fairWaiter {
+	if len(fb.keys) == 0 {
+		return nil
+	}
+
+	if fb.cursor >= len(fb.keys) {
+		fb.cursor = 0
+	}
+
+	return fb.queues[fb.keys[fb.cursor]][0]
+}
+
+// grant hands the tokens to w, the first waiter of the key in turn, and moves
+// on to the next key once the key has had its turn. It should be called with
+// mutex held.
+func (fb *FairKeyedBucket) grant(w *fairWaiter) {
+	queue := fb.queues[w.key][1:]
+	fb.served++
+
+	if len(queue) == 0 {
+		// The cursor is left on the key after w.key.
+		delete(fb.queues, w.key)
+		fb.keys = append(fb.keys[:fb.cursor], fb.keys[fb.cursor+1:]...)
+		fb.served = 0
+	} else {
+		fb.queues[w.key] = queue
+
+		if weight, ok := fb.weights[w.key]; !ok || fb.served >= weight {
+			fb.cursor++
+			fb.served = 0
+		}
+	}
+
+	w.granted = true
+	w.ready <- struct{}{}
+}
+
+// backoff waits for fairRetryInterval before taking from the parent again, it
+// returns false if fb is destroyed meanwhile.
+func (fb *FairKeyedBucket) backoff() bool {
+	timer := fb.parent.newTimer(fairRetryInterval)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return true
+	case <-fb.done:
+		return false
+	}
+}
+
+// dispatchDaemon takes the tokens from the parent for the waiters in turn.
+func (fb *FairKeyedBucket) dispatchDaemon() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-fb.done
+		cancel()
+	}()
+
+	for {
+		fb.mutex.Lock()
+		w := fb.front()
+		fb.mutex.Unlock()
+
+		if w == nil {
+			select {
+			case <-fb.wake:
+				continue
+			case <-fb.done:
+				return
+			}
+		}
+
+		if err := fb.parent.TakeContext(ctx, w.count); err != nil {
+			switch err {
+			case ErrTooManyWaiters:
+				// The waiting queue of the parent is full, retry once it may
+				// have room again.
+				if fb.backoff() {
+					continue
+				}
+			case context.Canceled:
+				// fb is destroyed.
+			default:
+				// The parent is destroyed or closed, so the waiters would
+				// never be served.
+				fb.Destroy()
+			}
+
+			return
+		}
+
+		fb.mutex.Lock()
+
+		if w.granted || fb.front() != w {
+			// w has given up meanwhile.
+			fb.mutex.Unlock()
+			fb.parent.Refund(w.count)
+
+			continue
+		}
+
+		fb.grant(w)
+		fb.mutex.Unlock()
+	}
+}
@@ -0,0 +1,173 @@
+package bucket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// takeFairly keeps taking a token for key with goroutines goroutines until
+// ctx is done, and returns how many tokens are taken.
+func takeFairly(ctx context.Context, fb *FairKeyedBucket, key string, goroutines int) func() int {
+	mutex := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	taken := 0
+
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for fb.TakeContext(ctx, key, 1) == nil {
+				mutex.Lock()
+				taken++
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	return func() int {
+		wg.Wait()
+
+		return taken
+	}
+}
+
+func TestFairKeyedBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should share the parent equally among the keys", func(t *testing.T) {
+		parent := NewEmpty(time.Millisecond*10, 1)
+		defer parent.Destroy()
+
+		fb := NewFairKeyed(parent, time.Minute, 1000, 0)
+		defer fb.Destroy()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+		defer cancel()
+
+		a := takeFairly(ctx, fb, "a", 5)
+		b := takeFairly(ctx, fb, "b", 1)
+		c := takeFairly(ctx, fb, "c", 1)
+
+		na, nb, nc := a(), b(), c()
+		total := float64(na + nb + nc)
+
+		assert.True(total > 20)
+		assert.InDelta(total/3, na, 3)
+		assert.InDelta(total/3, nb, 3)
+		assert.InDelta(total/3, nc, 3)
+	})
+
+	t.Run("Should share the parent by the weights of the keys", func(t *testing.T) {
+		parent := NewEmpty(time.Millisecond*10, 1)
+		defer parent.Destroy()
+
+		fb := NewFairKeyed(parent, time.Minute, 1000, 0)
+		defer fb.Destroy()
+
+		fb.SetWeight("a", 2)
+		assert.Panics(func() { fb.SetWeight("a", 0) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+		defer cancel()
+
+		a := takeFairly(ctx, fb, "a", 2)
+		b := takeFairly(ctx, fb, "b", 2)
+
+		na, nb := a(), b()
+		total := float64(na + nb)
+
+		assert.InDelta(total*2/3, na, 3)
+		assert.InDelta(total/3, nb, 3)
+	})
+
+	t.Run("Should retry when the waiting queue of the parent is full", func(t *testing.T) {
+		parent, err := NewBucket(time.Minute, 2, WithInitialTokens(0), WithMaxWaiters(1))
+		assert.Nil(err)
+		defer parent.Destroy()
+
+		go parent.Take(1)
+		waitUntil(func() bool { return parent.WaitingCount() == 1 })
+
+		fb := NewFairKeyed(parent, time.Minute, 5, 0)
+		defer fb.Destroy()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		done := make(chan error)
+
+		go func() {
+			done <- fb.TakeContext(ctx, "a", 1)
+		}()
+
+		time.Sleep(time.Millisecond * 30)
+		parent.AddTokens(2)
+
+		assert.Nil(<-done)
+		assert.Equal(int64(0), parent.Available())
+	})
+
+	t.Run("Should release the waiters when the parent is closed", func(t *testing.T) {
+		parent := NewEmpty(time.Minute, 1)
+		defer parent.Destroy()
+
+		go parent.Take(1)
+		waitUntil(func() bool { return parent.WaitingCount() == 1 })
+
+		closed := make(chan error)
+
+		go func() {
+			closed <- parent.Close(context.Background())
+		}()
+
+		waitUntil(func() bool {
+			parent.tokenMutex.Lock()
+			defer parent.tokenMutex.Unlock()
+
+			return parent.closed
+		})
+
+		fb := NewFairKeyed(parent, time.Minute, 5, 0)
+		defer fb.Destroy()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		assert.Equal(ErrBucketDestroyed, fb.TakeContext(ctx, "a", 1))
+		assert.Equal(int64(5), fb.keyed.Get("a").Available())
+
+		parent.AddTokens(1)
+		assert.Nil(<-closed)
+	})
+
+	t.Run("Should refund the key bucket when giving up", func(t *testing.T) {
+		parent := NewEmpty(time.Minute, 1)
+		defer parent.Destroy()
+
+		fb := NewFairKeyed(parent, time.Minute, 5, 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+
+		assert.Equal(context.DeadlineExceeded, fb.TakeContext(ctx, "a", 1))
+		assert.Equal(int64(5), fb.keyed.Get("a").Available())
+
+		done := make(chan error)
+
+		go func() {
+			done <- fb.TakeContext(context.Background(), "a", 1)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+		fb.Destroy()
+
+		assert.Equal(ErrBucketDestroyed, <-done)
+		assert.Panics(func() { fb.Take("a", 2) })
+	})
+}
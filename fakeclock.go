@@ -0,0 +1,262 @@
+package bucket
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FakeClock is a TimerClock whose time only moves forward by Advance, so a
+// bucket created WithClock can be tested without real sleeping. It is safe to
+// use under concurrency environments.
+type FakeClock struct {
+	mutex   *sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	tickers []*fakeTicker
+	timers  []*fakeTimer
+}
+
+var _ TimerClock = (*FakeClock)(nil)
+
+// NewFakeClock returns a new FakeClock starting at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{
+		mutex: &sync.Mutex{},
+		now:   now,
+	}
+
+	c.cond = sync.NewCond(c.mutex)
+
+	return c
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// NewTicker returns a new Ticker which ticks every d as the clock advances.
+// It panics if d is not positive.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic(fmt.Sprintf("ratelimit: ticker period %v should > 0", d))
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := &fakeTicker{
+		clock:  c,
+		c:      make(chan time.Time),
+		period: d,
+		next:   c.now.Add(d),
+		stop:   make(chan struct{}),
+	}
+
+	c.tickers = append(c.tickers, t)
+
+	return t
+}
+
+// NewTimer returns a new Timer which fires once the clock advances by d.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := &fakeTimer{
+		clock: c,
+		c:     make(chan time.Time, 1),
+		at:    c.now.Add(d),
+	}
+
+	if d <= 0 {
+		t.c <- c.now
+	} else {
+		c.timers = append(c.timers, t)
+	}
+
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers due in
+// order. Each tick is delivered synchronously: Advance returns only after the
+// goroutine receiving a tick is back waiting for the next one, so the buckets
+// using the clock have refilled when it returns. The receivers should call C
+// every time they wait for a tick, as the buckets do.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	end := c.now.Add(d)
+
+	for {
+		ticker, timer := c.nextEvent(end)
+
+		switch {
+		case timer != nil:
+			c.now = timer.at
+			c.removeTimer(timer)
+			timer.c <- c.now
+		case ticker != nil:
+			c.now = ticker.next
+			ticker.next = ticker.next.Add(ticker.period)
+			ticker.tick(c.now)
+		default:
+			c.now = end
+			return
+		}
+	}
+}
+
+// nextEvent returns the first ticker or timer due no later than end, the
+// timers come first at the same time. It should be called with mutex held.
+func (c *FakeClock) nextEvent(end time.Time) (*fakeTicker, *fakeTimer) {
+	var ticker *fakeTicker
+	var timer *fakeTimer
+
+	for _, t := range c.timers {
+		if !t.at.After(end) && (timer == nil || t.at.Before(timer.at)) {
+			timer = t
+		}
+	}
+
+	for _, t := range c.tickers {
+		if !t.next.After(end) && (ticker == nil || t.next.Before(ticker.next)) {
+			ticker = t
+		}
+	}
+
+	if timer != nil && ticker != nil && ticker.next.Before(timer.at) {
+		return ticker, nil
+	}
+
+	if timer != nil {
+		return nil, timer
+	}
+
+	return ticker, nil
+}
+
+func (c *FakeClock) removeTimer(t *fakeTimer) bool {
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *FakeClock) removeTicker(t *fakeTicker) {
+	for i, ticker := range c.tickers {
+		if ticker == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+	// waiting is set when the receiver calls C, i.e. it is done with the last
+	// tick and is waiting for the next one.
+	waiting bool
+	stopped bool
+	stop    chan struct{}
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	t.waiting = true
+	t.clock.cond.Broadcast()
+
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	if !t.stopped {
+		t.stopped = true
+		close(t.stop)
+		t.clock.removeTicker(t)
+		t.clock.cond.Broadcast()
+	}
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic(fmt.Sprintf("ratelimit: ticker period %v should > 0", d))
+	}
+
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	t.period = d
+	t.next = t.clock.now.Add(d)
+
+	if t.stopped {
+		t.stopped = false
+		t.stop = make(chan struct{})
+		t.clock.tickers = append(t.clock.tickers, t)
+	}
+}
+
+// tick delivers now to the receiver and waits until it is done with it, it
+// should be called with the mutex of the clock held.
+func (t *fakeTicker) tick(now time.Time) {
+	c := t.clock
+
+	for !t.waiting && !t.stopped {
+		c.cond.Wait()
+	}
+
+	if t.stopped {
+		return
+	}
+
+	t.waiting = false
+	stop := t.stop
+
+	// The receiver needs the clock to handle the tick.
+	c.mutex.Unlock()
+
+	select {
+	case t.c <- now:
+	case <-stop:
+	}
+
+	c.mutex.Lock()
+
+	for !t.waiting && !t.stopped {
+		c.cond.Wait()
+	}
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	c     chan time.Time
+	at    time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	return t.clock.removeTimer(t)
+}
@@ -0,0 +1,97 @@
+package bucket
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitUntil yields until cond is true, so the tests driven by FakeClock need
+// no real sleeping.
+func waitUntil(cond func() bool) {
+	for !cond() {
+		runtime.Gosched()
+	}
+}
+
+func (c *FakeClock) timerCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.timers)
+}
+
+func TestFakeClock(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should fire the timers when advanced", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		timer := c.NewTimer(time.Second)
+		stopped := c.NewTimer(time.Second)
+
+		c.Advance(time.Millisecond * 999)
+		assert.Equal(0, len(timer.C()))
+		assert.True(stopped.Stop())
+
+		c.Advance(time.Millisecond)
+		assert.Equal(time.Unix(1, 0), <-timer.C())
+		assert.False(timer.Stop())
+		assert.Equal(0, len(stopped.C()))
+		assert.Equal(time.Unix(1, 0), c.Now())
+	})
+
+	t.Run("Should drive a bucket without real sleeping", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 2, WithClock(c), WithRand(rand.New(rand.NewSource(1))))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(2))
+		assert.False(b.TryTake(1))
+
+		c.Advance(time.Second)
+		assert.Equal(int64(1), b.Available())
+
+		done := make(chan bool)
+
+		go func() {
+			done <- b.TakeMaxDuration(2, time.Millisecond*500)
+		}()
+
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		c.Advance(time.Millisecond * 500)
+		assert.False(<-done)
+		assert.Equal(int64(1), b.Available())
+
+		go func() {
+			b.Take(2)
+			done <- true
+		}()
+
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		c.Advance(time.Millisecond * 500)
+		assert.True(<-done)
+		assert.Equal(int64(0), b.Available())
+
+		jitter := time.Duration(rand.New(rand.NewSource(1)).Int63n(int64(time.Second)))
+
+		go func() {
+			b.TakeWithJitter(1, time.Second)
+			done <- true
+		}()
+
+		waitUntil(func() bool { return c.timerCount() == 1 })
+		c.Advance(jitter - 1)
+		assert.Equal(0, b.WaitingCount())
+
+		c.Advance(1)
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+
+		c.Advance(time.Second - jitter)
+		assert.True(<-done)
+		assert.Equal(time.Unix(3, 0), c.Now())
+	})
+}
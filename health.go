@@ -0,0 +1,49 @@
+package bucket
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// healthyTicks is how many intervals the daemon may miss before the bucket
+// is not healthy.
+const healthyTicks = 3
+
+// Healthy reports whether the daemon goroutine of the bucket is still
+// refilling it, i.e. it has ticked within the last few intervals, e.g. for a
+// health check endpoint. A bucket without daemon, like a lazy one or one with
+// zero interval, is always healthy unless it is destroyed.
+func (tb *TokenBucket) Healthy() bool {
+	select {
+	case <-tb.done:
+		return false
+	default:
+	}
+
+	if tb.ticker == nil {
+		return true
+	}
+
+	return tb.clock.Now().UnixNano() <= atomic.LoadInt64(&tb.staleAt)
+}
+
+// Saturated reports whether the bucket is actively throttling, i.e. it has
+// no available tokens and goroutines are waiting for them, e.g. for alerting
+// on a sustained throttling. A lazy bucket, which has no waiting queue, is
+// never saturated.
+func (tb *TokenBucket) Saturated() bool {
+	return tb.loadAvail() <= 0 && tb.WaitingCount() > 0
+}
+
+// ticked records that the daemon is alive now, it should be called with
+// tokenMutex held, or before the daemon is started.
+func (tb *TokenBucket) ticked() {
+	now := tb.clock.Now().UnixNano()
+	staleAt := int64(math.MaxInt64)
+
+	if d := int64(tb.interval); d <= (math.MaxInt64-now)/healthyTicks {
+		staleAt = now + healthyTicks*d
+	}
+
+	atomic.StoreInt64(&tb.staleAt, staleAt)
+}
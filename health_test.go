@@ -0,0 +1,82 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthy(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should report a stalled daemon as not healthy", func(t *testing.T) {
+		b := New(time.Millisecond*10, 1)
+		defer b.Destroy()
+
+		assert.True(b.Healthy())
+
+		// The daemon can not tick while tokenMutex is held.
+		b.tokenMutex.Lock()
+		time.Sleep(time.Millisecond * 60)
+		assert.False(b.Healthy())
+		b.tokenMutex.Unlock()
+
+		time.Sleep(time.Millisecond * 20)
+		assert.True(b.Healthy())
+	})
+
+	t.Run("Should restart the daemon after a panic", func(t *testing.T) {
+		b := NewEmpty(time.Millisecond*10, 2)
+		defer b.Destroy()
+
+		panicked := make(chan struct{})
+
+		b.OnRefill(func(avail int64) {
+			b.OnRefill(nil)
+			close(panicked)
+			panic("boom")
+		})
+
+		<-panicked
+		time.Sleep(time.Millisecond * 50)
+
+		assert.True(b.Healthy())
+		assert.Equal(int64(2), b.Available())
+	})
+
+	t.Run("Should report the buckets without daemon as healthy until destroyed", func(t *testing.T) {
+		b := NewLazy(time.Second, 1)
+		assert.True(b.Healthy())
+
+		b = New(0, 1)
+		assert.True(b.Healthy())
+
+		b.Destroy()
+		assert.False(b.Healthy())
+	})
+}
+
+func TestSaturated(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should report a drained bucket with waiters as saturated", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 2, WithClock(c))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		assert.False(b.Saturated())
+
+		assert.True(b.TryTake(2))
+		assert.False(b.Saturated())
+
+		go b.Take(1)
+
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		assert.True(b.Saturated())
+
+		c.Advance(time.Second)
+		assert.False(b.Saturated())
+	})
+}
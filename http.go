@@ -0,0 +1,125 @@
+package bucket
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type roundTripper struct {
+	next http.RoundTripper
+	tb   Limiter
+}
+
+// contextTaker is implemented by the limiters which can give up waiting for
+// tokens when a context is done, like TokenBucket.
+type contextTaker interface {
+	TakeContext(ctx context.Context, count int64) error
+}
+
+// NewRoundTripper returns a http.RoundTripper which takes one token from tb
+// before delegating every request to next, so the outbound requests are
+// limited by the fill rate of tb. If next is nil, http.DefaultTransport is
+// used. When the context of the request is done before the token is taken,
+// the request is not sent and the context error is returned, if tb has a
+// TakeContext method like TokenBucket.
+func NewRoundTripper(next http.RoundTripper, tb Limiter) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &roundTripper{next: next, tb: tb}
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if ct, ok := rt.tb.(contextTaker); ok {
+		if err := ct.TakeContext(req.Context(), 1); err != nil {
+			return nil, err
+		}
+	} else {
+		rt.tb.Take(1)
+	}
+
+	return rt.next.RoundTrip(req)
+}
+
+type middleware struct {
+	tb      Limiter
+	maxWait time.Duration
+	next    http.Handler
+}
+
+// MiddlewareOption configures the middleware returned by Middleware.
+type MiddlewareOption func(m *middleware)
+
+// WithMaxWait makes the middleware wait up to max for a token before
+// rejecting a request, instead of rejecting it immediately.
+func WithMaxWait(max time.Duration) MiddlewareOption {
+	return func(m *middleware) {
+		m.maxWait = max
+	}
+}
+
+// Middleware returns a http middleware which takes one token from tb for
+// every request. When there is no token available, the request is rejected
+// with 429 Too Many Requests and a Retry-After header telling how many seconds
+// the client should wait before retrying.
+func Middleware(tb Limiter, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		m := &middleware{tb: tb, next: next}
+
+		for _, opt := range opts {
+			opt(m)
+		}
+
+		return m
+	}
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var ok bool
+
+	if m.maxWait > 0 {
+		ok = m.tb.TakeMaxDuration(1, m.maxWait)
+	} else {
+		ok = m.tb.TryTake(1)
+	}
+
+	if !ok {
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter(m.tb), 10))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+
+	m.next.ServeHTTP(w, r)
+}
+
+// retryAfter returns how many seconds it takes until a token is available
+// in l, which is at least one. It is always one if l is not a TokenBucket.
+func retryAfter(l Limiter) int64 {
+	tb, ok := l.(*TokenBucket)
+
+	if !ok {
+		return 1
+	}
+
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	if tb.interval == 0 {
+		// The bucket is never refilled, only a Refund can bring the token.
+		return 1
+	}
+
+	tb.refill()
+
+	d := tb.refillTime(1 - tb.loadAvail()).Sub(tb.clock.Now())
+	seconds := int64((d + time.Second - 1) / time.Second)
+
+	if seconds < 1 {
+		return 1
+	}
+
+	return seconds
+}
@@ -0,0 +1,158 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTripper(t *testing.T) {
+	assert := assert.New(t)
+
+	var hits int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+	}))
+	defer server.Close()
+
+	t.Run("Should space out the requests at the fill rate", func(t *testing.T) {
+		start := time.Now()
+		b := New(time.Millisecond*50, 1)
+		defer b.Destroy()
+
+		client := &http.Client{Transport: NewRoundTripper(nil, b)}
+
+		for i := 0; i < 3; i++ {
+			res, err := client.Get(server.URL)
+			assert.Nil(err)
+			res.Body.Close()
+		}
+
+		assert.True(time.Now().Sub(start) >= time.Millisecond*100)
+		assert.Equal(int64(3), atomic.LoadInt64(&hits))
+	})
+
+	t.Run("Should not send the request when the context is done", func(t *testing.T) {
+		atomic.StoreInt64(&hits, 0)
+
+		b := New(time.Minute, 1)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		assert.Nil(err)
+
+		client := &http.Client{Transport: NewRoundTripper(http.DefaultTransport, b)}
+
+		_, err = client.Do(req)
+
+		assert.True(errors.Is(err, context.DeadlineExceeded))
+		assert.Equal(int64(0), atomic.LoadInt64(&hits))
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(h http.Handler) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		return rec
+	}
+
+	t.Run("Should reject requests with 429 when no token is available", func(t *testing.T) {
+		b := New(time.Second*3, 2)
+		defer b.Destroy()
+
+		h := Middleware(b)(ok)
+
+		assert.Equal(http.StatusOK, serve(h).Code)
+		assert.Equal(http.StatusOK, serve(h).Code)
+
+		rec := serve(h)
+
+		assert.Equal(http.StatusTooManyRequests, rec.Code)
+		assert.Equal("3", rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("Should pass requests again after refill", func(t *testing.T) {
+		b := New(time.Millisecond*50, 1)
+		defer b.Destroy()
+
+		h := Middleware(b)(ok)
+
+		assert.Equal(http.StatusOK, serve(h).Code)
+		assert.Equal(http.StatusTooManyRequests, serve(h).Code)
+		assert.Equal("1", serve(h).Header().Get("Retry-After"))
+
+		time.Sleep(time.Millisecond * 80)
+
+		assert.Equal(http.StatusOK, serve(h).Code)
+	})
+
+	t.Run("Should wait up to max for a token with WithMaxWait", func(t *testing.T) {
+		b := New(time.Millisecond*50, 1)
+		defer b.Destroy()
+
+		h := Middleware(b, WithMaxWait(time.Millisecond*200))(ok)
+
+		assert.Equal(http.StatusOK, serve(h).Code)
+		assert.Equal(http.StatusOK, serve(h).Code)
+
+		h = Middleware(b, WithMaxWait(time.Millisecond*10))(ok)
+
+		assert.Equal(http.StatusTooManyRequests, serve(h).Code)
+	})
+
+	t.Run("Should accept any Limiter implementation", func(t *testing.T) {
+		l := &fakeLimiter{avail: 1}
+		h := Middleware(l)(ok)
+
+		assert.Equal(http.StatusOK, serve(h).Code)
+		assert.Equal(http.StatusTooManyRequests, serve(h).Code)
+		assert.Equal("1", serve(h).Header().Get("Retry-After"))
+		assert.Equal(int64(0), l.Available())
+	})
+}
+
+type fakeLimiter struct {
+	avail int64
+}
+
+func (l *fakeLimiter) TryTake(count int64) bool {
+	if count > l.avail {
+		return false
+	}
+
+	l.avail -= count
+
+	return true
+}
+
+func (l *fakeLimiter) Take(count int64) {
+	l.TryTake(count)
+}
+
+func (l *fakeLimiter) TakeMaxDuration(count int64, max time.Duration) bool {
+	return l.TryTake(count)
+}
+
+func (l *fakeLimiter) Available() int64 {
+	return l.avail
+}
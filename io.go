@@ -0,0 +1,150 @@
+package bucket
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+type writer struct {
+	w  io.Writer
+	tb Limiter
+	// deadline returns when waiting for tokens should give up, it is nil or
+	// returns the zero time for no deadline.
+	deadline func() time.Time
+}
+
+// NewWriter returns a writer which writes to w after taking one token from tb
+// for every byte, so the throughput is limited by the fill rate of tb. Large
+// writes are split into chunks of at most the capability of tb, if tb has a
+// Capability method like TokenBucket. The tokens of the bytes not written are
+// given back if tb has a Refund method. A write returns ErrBucketDestroyed if
+// tb is a TokenBucket destroyed while waiting for tokens.
+func NewWriter(w io.Writer, tb Limiter) io.Writer {
+	return &writer{w: w, tb: tb}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		n := chunkSize(w.tb, len(p))
+
+		if err := takeBefore(w.tb, n, w.deadline); err != nil {
+			return written, err
+		}
+
+		m, err := w.w.Write(p[:n])
+		written += m
+
+		if r, ok := w.tb.(refunder); ok && int64(m) < n {
+			r.Refund(n - int64(m))
+		}
+
+		if err != nil {
+			return written, err
+		}
+
+		if int64(m) < n {
+			return written, io.ErrShortWrite
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+type reader struct {
+	r        io.Reader
+	tb       Limiter
+	deadline func() time.Time
+}
+
+// NewReader returns a reader which reads from r and takes one token from tb
+// for every byte read before returning it, so the throughput is limited by
+// the fill rate of tb. A single read returns at most the capability of tb
+// bytes, if tb has a Capability method like TokenBucket. A read returns
+// ErrBucketDestroyed along with the bytes already read if tb is a TokenBucket
+// destroyed while waiting for tokens.
+func NewReader(r io.Reader, tb Limiter) io.Reader {
+	return &reader{r: r, tb: tb}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return r.r.Read(p)
+	}
+
+	n, err := r.r.Read(p[:chunkSize(r.tb, len(p))])
+
+	if n > 0 {
+		if terr := takeBefore(r.tb, int64(n), r.deadline); terr != nil {
+			return n, terr
+		}
+	}
+
+	return n, err
+}
+
+// capabilityReporter is implemented by the limiters which report their
+// capability, like TokenBucket.
+type capabilityReporter interface {
+	Capability() int64
+}
+
+// refunder is implemented by the limiters which can take tokens back, like
+// TokenBucket.
+type refunder interface {
+	Refund(count int64)
+}
+
+// chunkSize returns how many of size bytes can be transferred with the
+// tokens taken at once from tb.
+func chunkSize(tb Limiter, size int) int64 {
+	n := int64(size)
+
+	if cr, ok := tb.(capabilityReporter); ok {
+		if cap := cr.Capability(); n > cap && cap > 0 {
+			n = cap
+		}
+	}
+
+	return n
+}
+
+// takeBefore takes n tokens from tb, giving up with os.ErrDeadlineExceeded
+// once the time returned by deadline passes.
+func takeBefore(tb Limiter, n int64, deadline func() time.Time) error {
+	var d time.Time
+
+	if deadline != nil {
+		d = deadline()
+	}
+
+	ct, ok := tb.(contextTaker)
+
+	if !ok {
+		if d.IsZero() {
+			tb.Take(n)
+		} else if !tb.TakeMaxDuration(n, time.Until(d)) {
+			return os.ErrDeadlineExceeded
+		}
+
+		return nil
+	}
+
+	if d.IsZero() {
+		return ct.TakeContext(context.Background(), n)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), d)
+	defer cancel()
+
+	if err := ct.TakeContext(ctx, n); err != context.DeadlineExceeded {
+		return err
+	}
+
+	return os.ErrDeadlineExceeded
+}
@@ -0,0 +1,146 @@
+package bucket
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type errWriter struct {
+	n   int
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return w.n, w.err
+	}
+
+	return len(p), nil
+}
+
+func TestWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should write at the fill rate of the bucket", func(t *testing.T) {
+		start := time.Now()
+		b := NewEmpty(time.Millisecond*10, 10)
+		defer b.Destroy()
+
+		buf := &bytes.Buffer{}
+		data := bytes.Repeat([]byte("a"), 30)
+
+		n, err := NewWriter(buf, b).Write(data)
+
+		assert.Nil(err)
+		assert.Equal(30, n)
+		assert.Equal(data, buf.Bytes())
+		assert.True(time.Now().Sub(start) >= time.Millisecond*250)
+		assert.True(time.Now().Sub(start) < time.Millisecond*600)
+	})
+
+	t.Run("Should return the error of the underlying writer", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destroy()
+
+		e := errors.New("boom")
+		n, err := NewWriter(&errWriter{n: 3, err: e}, b).Write(make([]byte, 5))
+
+		assert.Equal(e, err)
+		assert.Equal(3, n)
+		assert.Equal(int64(7), b.Available())
+	})
+
+	t.Run("Should return io.ErrShortWrite on silent short writes", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destroy()
+
+		n, err := NewWriter(&errWriter{n: 3}, b).Write(make([]byte, 5))
+
+		assert.Equal(io.ErrShortWrite, err)
+		assert.Equal(3, n)
+	})
+
+	t.Run("Should return ErrBucketDestroyed when the bucket is destroyed", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		b.Destroy()
+
+		assert.True(b.TryTake(10))
+
+		n, err := NewWriter(&bytes.Buffer{}, b).Write(make([]byte, 5))
+
+		assert.Equal(ErrBucketDestroyed, err)
+		assert.Equal(0, n)
+	})
+
+	t.Run("Should accept any Limiter implementation", func(t *testing.T) {
+		l := &fakeLimiter{avail: 5}
+		buf := &bytes.Buffer{}
+
+		n, err := NewWriter(buf, l).Write([]byte("abc"))
+
+		assert.Nil(err)
+		assert.Equal(3, n)
+		assert.Equal("abc", buf.String())
+		assert.Equal(int64(2), l.Available())
+	})
+}
+
+func TestReader(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should read at the fill rate of the bucket", func(t *testing.T) {
+		start := time.Now()
+		b := NewEmpty(time.Millisecond*10, 10)
+		defer b.Destroy()
+
+		data := bytes.Repeat([]byte("abc"), 10)
+
+		read, err := io.ReadAll(NewReader(bytes.NewReader(data), b))
+
+		assert.Nil(err)
+		assert.Equal(data, read)
+		assert.True(time.Now().Sub(start) >= time.Millisecond*250)
+		assert.True(time.Now().Sub(start) < time.Millisecond*600)
+	})
+
+	t.Run("Should take tokens for the bytes actually read", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destroy()
+
+		p := make([]byte, 8)
+		n, err := NewReader(bytes.NewReader([]byte("abc")), b).Read(p)
+
+		assert.Nil(err)
+		assert.Equal(3, n)
+		assert.Equal([]byte("abc"), p[:n])
+		assert.Equal(int64(7), b.Available())
+	})
+
+	t.Run("Should not read more than the capability at once", func(t *testing.T) {
+		b := New(time.Minute, 4)
+		defer b.Destroy()
+
+		p := make([]byte, 8)
+		n, err := NewReader(bytes.NewReader([]byte("abcdefgh")), b).Read(p)
+
+		assert.Nil(err)
+		assert.Equal(4, n)
+		assert.Equal(int64(0), b.Available())
+	})
+
+	t.Run("Should accept any Limiter implementation", func(t *testing.T) {
+		l := &fakeLimiter{avail: 10}
+
+		p := make([]byte, 8)
+		n, err := NewReader(bytes.NewReader([]byte("abcdefgh")), l).Read(p)
+
+		assert.Nil(err)
+		assert.Equal(8, n)
+		assert.Equal(int64(2), l.Available())
+	})
+}
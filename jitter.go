@@ -0,0 +1,47 @@
+package bucket
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// TakeWithJitter takes specified count tokens like Take, but if it has to
+// wait, it first sleeps a random jitter up to maxJitter, so the callers
+// limited at the same instant do not retry in lockstep.
+func (tb *TokenBucket) TakeWithJitter(count int64, maxJitter time.Duration) {
+	if maxJitter < 0 {
+		panic(fmt.Sprintf("ratelimit: max jitter %v should not be negative", maxJitter))
+	}
+
+	if tb.TryTake(count) {
+		return
+	}
+
+	if maxJitter > 0 {
+		timer := tb.newTimer(tb.jitter(maxJitter))
+
+		select {
+		case <-timer.C():
+		case <-tb.done:
+			timer.Stop()
+
+			return
+		}
+	}
+
+	tb.Take(count)
+}
+
+// jitter returns a random duration in [0, max).
+func (tb *TokenBucket) jitter(max time.Duration) time.Duration {
+	if tb.rand == nil {
+		return time.Duration(rand.Int63n(int64(max)))
+	}
+
+	// rand.Rand is not safe for concurrent use.
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
+	return time.Duration(tb.rand.Int63n(int64(max)))
+}
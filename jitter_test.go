@@ -0,0 +1,49 @@
+package bucket
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitter(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should sleep the jitter before waiting for tokens", func(t *testing.T) {
+		max := time.Millisecond * 100
+		expected := time.Duration(rand.New(rand.NewSource(42)).Int63n(int64(max)))
+
+		b, err := NewBucket(time.Millisecond*10, 1, WithInitialTokens(0),
+			WithRandSource(rand.NewSource(42)))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		start := time.Now()
+		b.TakeWithJitter(1, max)
+		elapsed := time.Since(start)
+
+		assert.True(elapsed >= expected)
+		assert.True(elapsed < expected+time.Millisecond*30)
+	})
+
+	t.Run("Should not sleep when the tokens are available", func(t *testing.T) {
+		b := New(time.Minute, 1)
+		defer b.Destroy()
+
+		start := time.Now()
+		b.TakeWithJitter(1, time.Second)
+		assert.True(time.Since(start) < time.Millisecond*20)
+	})
+
+	t.Run("Should reject invalid arguments", func(t *testing.T) {
+		b := New(time.Minute, 1)
+		defer b.Destroy()
+
+		assert.Panics(func() { b.TakeWithJitter(1, -time.Second) })
+
+		_, err := NewBucket(time.Minute, 1, WithRandSource(nil))
+		assert.EqualError(err, "ratelimit: rand source should not be nil")
+	})
+}
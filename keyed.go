@@ -0,0 +1,137 @@
+package bucket
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// KeyedBucket is a collection of token buckets keyed by string, e.g. for
+// per-user or per-IP rate limiting. The buckets are created on demand with
+// the same fill interval and capability, and are safe to use under
+// concurrency environments.
+type KeyedBucket struct {
+	interval    time.Duration
+	cap         int64
+	ttl         time.Duration
+	mutex       *sync.Mutex
+	buckets     map[string]*keyedEntry
+	done        chan struct{}
+	destroyOnce *sync.Once
+}
+
+type keyedEntry struct {
+	tb       *TokenBucket
+	lastUsed time.Time
+}
+
+// NewKeyed returns a new KeyedBucket whose buckets have specified fill
+// interval and capability. A bucket which is not got for ttl and is full again
+// is destroyed and evicted, so evicting never grants a key more tokens than it
+// would have had. No bucket is evicted if ttl is 0.
+func NewKeyed(interval time.Duration, cap int64, ttl time.Duration) *KeyedBucket {
+	if err := checkArgs(interval, cap); err != nil {
+		panic(err.Error())
+	}
+
+	if ttl < 0 {
+		panic(fmt.Sprintf("ratelimit: ttl %v should not be negative", ttl))
+	}
+
+	kb := &KeyedBucket{
+		interval:    interval,
+		cap:         cap,
+		ttl:         ttl,
+		mutex:       &sync.Mutex{},
+		buckets:     make(map[string]*keyedEntry),
+		done:        make(chan struct{}),
+		destroyOnce: &sync.Once{},
+	}
+
+	if ttl > 0 {
+		go kb.evictDaemon()
+	}
+
+	return kb
+}
+
+// Get returns the bucket of key, which is created if it does not exist.
+// Callers should not keep the returned bucket for longer than the ttl, as it
+// may be evicted and destroyed meanwhile.
+func (kb *KeyedBucket) Get(key string) *TokenBucket {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+
+	e, ok := kb.buckets[key]
+
+	if !ok {
+		e = &keyedEntry{tb: New(kb.interval, kb.cap)}
+		kb.buckets[key] = e
+	}
+
+	e.lastUsed = time.Now()
+
+	return e.tb
+}
+
+// Len returns how many buckets are in the collection.
+func (kb *KeyedBucket) Len() int {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+
+	return len(kb.buckets)
+}
+
+// Destroy destroys all the buckets and stops the eviction goroutine. It is
+// safe to call Destroy more than once.
+func (kb *KeyedBucket) Destroy() {
+	kb.destroyOnce.Do(func() {
+		close(kb.done)
+
+		kb.mutex.Lock()
+		defer kb.mutex.Unlock()
+
+		for key, e := range kb.buckets {
+			e.tb.Destroy()
+			delete(kb.buckets, key)
+		}
+	})
+}
+
+func (kb *KeyedBucket) evictDaemon() {
+	period := kb.ttl / 2
+
+	// time.NewTicker panics for a period of 0, i.e. a ttl of 1ns.
+	if period <= 0 {
+		period = kb.ttl
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-kb.done:
+			return
+		case <-ticker.C:
+		}
+
+		kb.evict()
+	}
+}
+
+func (kb *KeyedBucket) evict() {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+
+	now := time.Now()
+
+	for key, e := range kb.buckets {
+		if now.Sub(e.lastUsed) < kb.ttl || e.tb.Available() < e.tb.Capability() {
+			continue
+		}
+
+		e.tb.Destroy()
+		delete(kb.buckets, key)
+	}
+}
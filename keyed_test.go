@@ -0,0 +1,106 @@
+package bucket
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyedBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should return the same bucket for the same key", func(t *testing.T) {
+		kb := NewKeyed(time.Minute, 10, 0)
+		defer kb.Destroy()
+
+		buckets := make([]*TokenBucket, 50)
+		wg := &sync.WaitGroup{}
+
+		for i := range buckets {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+				buckets[i] = kb.Get("a")
+			}(i)
+		}
+
+		wg.Wait()
+
+		for _, b := range buckets {
+			assert.True(b == buckets[0])
+		}
+
+		assert.True(kb.Get("b") != buckets[0])
+		assert.Equal(2, kb.Len())
+	})
+
+	t.Run("Should keep the tokens of each key apart", func(t *testing.T) {
+		kb := NewKeyed(time.Minute, 1, 0)
+		defer kb.Destroy()
+
+		assert.True(kb.Get("a").TryTake(1))
+		assert.False(kb.Get("a").TryTake(1))
+		assert.True(kb.Get("b").TryTake(1))
+	})
+
+	t.Run("Should evict idle buckets after ttl", func(t *testing.T) {
+		kb := NewKeyed(time.Millisecond, 1, time.Millisecond*50)
+		defer kb.Destroy()
+
+		b := kb.Get("a")
+		assert.True(b.TryTake(1))
+
+		time.Sleep(time.Millisecond * 200)
+
+		assert.Equal(0, kb.Len())
+		assert.True(kb.Get("a") != b)
+	})
+
+	t.Run("Should evict with the shortest ttl", func(t *testing.T) {
+		kb := NewKeyed(time.Millisecond, 1, time.Nanosecond)
+		defer kb.Destroy()
+
+		kb.Get("a")
+
+		time.Sleep(time.Millisecond * 20)
+
+		assert.Equal(0, kb.Len())
+	})
+
+	t.Run("Should not evict buckets which are not full", func(t *testing.T) {
+		kb := NewKeyed(time.Minute, 1, time.Millisecond*20)
+		defer kb.Destroy()
+
+		assert.True(kb.Get("a").TryTake(1))
+
+		time.Sleep(time.Millisecond * 100)
+
+		assert.Equal(1, kb.Len())
+	})
+
+	t.Run("Should not leak goroutines when destroyed", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+
+		for i := 0; i < 20; i++ {
+			kb := NewKeyed(time.Millisecond, 1, time.Millisecond)
+			kb.Get("a")
+			kb.Get("b")
+			kb.Destroy()
+			kb.Destroy()
+		}
+
+		time.Sleep(time.Millisecond * 100)
+
+		assert.True(runtime.NumGoroutine() <= before)
+	})
+
+	t.Run("Should panic when arguments are invalid", func(t *testing.T) {
+		assert.Panics(func() { NewKeyed(-time.Second, 1, 0) })
+		assert.Panics(func() { NewKeyed(time.Second, -1, 0) })
+		assert.Panics(func() { NewKeyed(time.Second, 1, -time.Second) })
+	})
+}
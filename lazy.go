@@ -0,0 +1,139 @@
+package bucket
+
+import (
+	"math"
+	"time"
+)
+
+// NewLazy returns a new token bucket with specified fill interval and
+// capability. Unlike New, it runs no daemon goroutine: the available tokens
+// are computed from the elapsed time whenever the bucket is used, so there is
+// no need to call Destroy on it. The bucket is initially full.
+//
+// Waiters of a lazy bucket sleep until enough tokens should have accrued and
+// then race for them, so they are not served in FIFO order.
+func NewLazy(interval time.Duration, cap int64) *TokenBucket {
+	if interval == 0 {
+		panic("ratelimit: interval of a lazy bucket should > 0")
+	}
+
+	tb, err := newTokenBucket(interval, cap)
+
+	if err != nil {
+		panic(err.Error())
+	}
+
+	tb.lazy = true
+
+	return tb
+}
+
+// refill adds the tokens accrued since the last refill of a lazy bucket, it
+// should be called with tokenMutex held.
+func (tb *TokenBucket) refill() {
+	if !tb.lazy || tb.isPaused() {
+		return
+	}
+
+	ticks := int64(tb.clock.Now().Sub(tb.lastRefill) / tb.interval)
+
+	if ticks <= 0 {
+		return
+	}
+
+	tb.lastRefill = tb.lastRefill.Add(time.Duration(ticks) * tb.interval)
+	tb.addTicks(ticks)
+	tb.pourSpilled()
+}
+
+// refillTime returns when count more tokens will have been refilled, it
+// should be called with tokenMutex held.
+func (tb *TokenBucket) refillTime(count int64) time.Time {
+	if count <= 0 {
+		return tb.lastRefill
+	}
+
+	ticks := tb.ticksFor(count)
+
+	if tb.interval == 0 || ticks > math.MaxInt64/int64(tb.interval) {
+		return tb.lastRefill.Add(math.MaxInt64)
+	}
+
+	return tb.lastRefill.Add(time.Duration(ticks) * tb.interval)
+}
+
+// lazyWaitAndTake sleeps until need tokens are available in a lazy bucket and
+// then takes use tokens from it, see waitAndTakeUntil.
+func (tb *TokenBucket) lazyWaitAndTake(need, use int64, timeout <-chan time.Time, cancel <-chan struct{}) (int64, error) {
+	if ok, remaining := tb.tryTakeRemaining(need, use); ok {
+		return remaining, nil
+	}
+
+	if !tb.enterWait() {
+		return 0, ErrBucketClosed
+	}
+
+	defer tb.waiters.Done()
+
+	start := tb.clock.Now()
+
+	for {
+		tb.tokenMutex.Lock()
+
+		if ok := tb.take(need, use); ok {
+			remaining := tb.loadAvail()
+
+			tb.unlock()
+
+			tb.finishWait(start, nil)
+
+			return remaining, nil
+		}
+
+		var fired <-chan time.Time
+		var resumed <-chan struct{}
+		var timer Timer
+
+		if tb.isPaused() && (!tb.granting() || need > tb.loadAvail()) {
+			// A paused bucket is not refilled, so there is nothing to sleep
+			// for until it is resumed.
+			resumed = tb.resumed
+		} else {
+			wait := tb.leakyWait()
+
+			if avail := tb.loadAvail(); need > avail {
+				if d := tb.refillTime(need - avail).Sub(tb.clock.Now()); d > wait {
+					wait = d
+				}
+			}
+
+			timer = tb.newTimer(wait)
+			fired = timer.C()
+		}
+
+		tb.unlock()
+
+		var err error
+
+		select {
+		case <-fired:
+			continue
+		case <-resumed:
+			continue
+		case <-timeout:
+			err = errWaitTimeout
+		case <-cancel:
+			err = errWaitCanceled
+		case <-tb.done:
+			err = ErrBucketDestroyed
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		tb.finishWait(start, err)
+
+		return 0, err
+	}
+}
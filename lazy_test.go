@@ -0,0 +1,102 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazyTokenBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should init the lazy bucket with full available tokens", func(t *testing.T) {
+		b := NewLazy(time.Minute, 10)
+
+		assert.Nil(b.ticker)
+		assert.Equal(int64(10), b.Capability())
+		assert.Equal(int64(10), b.Availible())
+	})
+
+	t.Run("Should panic when interval is not positive", func(t *testing.T) {
+		assert.Panics(func() { NewLazy(0, 1) })
+		assert.Panics(func() { NewLazy(-time.Second, 1) })
+	})
+
+	t.Run("Should refill tokens from the elapsed time", func(t *testing.T) {
+		b := NewLazy(time.Millisecond*100, 2)
+
+		assert.True(b.TryTake(2))
+		assert.False(b.TryTake(1))
+
+		time.Sleep(time.Millisecond * 150)
+
+		assert.Equal(int64(1), b.Availible())
+		assert.True(b.TryTake(1))
+		assert.False(b.TryTake(1))
+	})
+
+	t.Run("Should not refill over capability", func(t *testing.T) {
+		b := NewLazy(time.Millisecond*10, 2)
+
+		assert.True(b.TryTake(1))
+
+		time.Sleep(time.Millisecond * 100)
+
+		assert.Equal(int64(2), b.Availible())
+	})
+
+	t.Run("Should take until count tokens available", func(t *testing.T) {
+		start := time.Now()
+		b := NewLazy(time.Millisecond*100, 2)
+
+		assert.True(b.TryTake(2))
+
+		b.Take(2)
+
+		assert.True(time.Now().Sub(start) >= time.Millisecond*200)
+		assert.Equal(int64(0), b.Availible())
+	})
+
+	t.Run("Should wait until count tokens available", func(t *testing.T) {
+		start := time.Now()
+		b := NewLazy(time.Millisecond*100, 1)
+
+		assert.True(b.TryTake(1))
+
+		b.Wait(1)
+
+		assert.True(time.Now().Sub(start) >= time.Millisecond*100)
+		assert.Equal(int64(1), b.Availible())
+	})
+
+	t.Run("Should return false when take reach max duration", func(t *testing.T) {
+		b := NewLazy(time.Second, 1)
+
+		assert.True(b.TryTake(1))
+		assert.False(b.TakeMaxDuration(1, time.Millisecond*100))
+		assert.Equal(int64(0), b.Availible())
+	})
+
+	t.Run("Should return ctx.Err() when context is done", func(t *testing.T) {
+		b := NewLazy(time.Second, 1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+
+		assert.True(b.TryTake(1))
+		assert.Equal(context.DeadlineExceeded, b.TakeContext(ctx, 1))
+	})
+
+	t.Run("Should refill with the new interval after SetInterval", func(t *testing.T) {
+		b := NewLazy(time.Minute, 1)
+
+		assert.True(b.TryTake(1))
+
+		b.SetInterval(time.Millisecond * 50)
+		time.Sleep(time.Millisecond * 100)
+
+		assert.Equal(int64(1), b.Availible())
+	})
+}
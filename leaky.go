@@ -0,0 +1,34 @@
+package bucket
+
+import "time"
+
+// NewLeaky returns a new token bucket with specified fill interval and
+// capability which behaves like a leaky bucket: besides having enough tokens,
+// every grant has to be at least interval after the previous one, so the
+// tokens accumulated in the bucket can not be taken in bursts and the takers
+// are served evenly spaced. Like NewLazy, it runs no daemon goroutine. The
+// bucket is initially full.
+func NewLeaky(interval time.Duration, cap int64) *TokenBucket {
+	tb := NewLazy(interval, cap)
+	tb.leaky = true
+
+	return tb
+}
+
+// leakyWait returns how long a leaky bucket has to wait before the next
+// grant, it should be called with tokenMutex held.
+func (tb *TokenBucket) leakyWait() time.Duration {
+	if !tb.leaky {
+		return 0
+	}
+
+	return tb.nextGrant.Sub(tb.clock.Now())
+}
+
+// leakyGranted delays the next grant of a leaky bucket after use tokens are
+// granted, it should be called with tokenMutex held.
+func (tb *TokenBucket) leakyGranted(use int64) {
+	if tb.leaky && use > 0 {
+		tb.nextGrant = tb.clock.Now().Add(tb.interval)
+	}
+}
@@ -0,0 +1,51 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeakyTokenBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should init the leaky bucket with full available tokens", func(t *testing.T) {
+		b := NewLeaky(time.Minute, 10)
+
+		assert.Equal(int64(10), b.Available())
+		assert.Panics(func() { NewLeaky(0, 1) })
+	})
+
+	t.Run("Should space back-to-back takes by interval even when full", func(t *testing.T) {
+		b := NewLeaky(time.Millisecond*100, 10)
+
+		b.Take(1)
+		start := time.Now()
+		b.Take(1)
+
+		assert.True(time.Now().Sub(start) >= time.Millisecond*100)
+		assert.Equal(int64(9), b.Available())
+	})
+
+	t.Run("Should not allow bursts with TryTake", func(t *testing.T) {
+		b := NewLeaky(time.Millisecond*50, 10)
+
+		assert.True(b.TryTake(1))
+		assert.False(b.TryTake(1))
+		assert.Equal(int64(0), b.TryTakeN(1))
+
+		time.Sleep(time.Millisecond * 60)
+
+		assert.True(b.TryTake(1))
+	})
+
+	t.Run("Should not delay the next grant after Wait", func(t *testing.T) {
+		b := NewLeaky(time.Minute, 10)
+
+		b.Wait(1)
+		b.Wait(1)
+
+		assert.True(b.TryTake(1))
+	})
+}
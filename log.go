@@ -0,0 +1,58 @@
+package bucket
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// logEnabled returns whether the bucket has a logger which logs debug
+// messages, so building the attributes is skipped otherwise.
+func (tb *TokenBucket) logEnabled() bool {
+	return tb.logger != nil && tb.logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// logEvent logs msg at debug level with the tokens available right now. It
+// should be called without holding tokenMutex.
+func (tb *TokenBucket) logEvent(msg string, attrs ...slog.Attr) {
+	attrs = append(attrs, slog.Int64("avail", tb.loadAvail()))
+	tb.logger.LogAttrs(context.Background(), slog.LevelDebug, msg, attrs...)
+}
+
+// logTake logs that count tokens are taken after waiting for waited.
+func (tb *TokenBucket) logTake(count int64, waited time.Duration) {
+	if tb.logEnabled() {
+		tb.logEvent("take", slog.Int64("count", count), slog.Duration("waited", waited))
+	}
+}
+
+// logEnqueue logs that a job waiting for count tokens is queued.
+func (tb *TokenBucket) logEnqueue(count int64) {
+	if tb.logEnabled() {
+		tb.logEvent("enqueue", slog.Int64("count", count))
+	}
+}
+
+// logWait logs the end of a wait for need tokens which took use tokens unless
+// err is not nil.
+func (tb *TokenBucket) logWait(need, use int64, waited time.Duration, err error) {
+	if !tb.logEnabled() {
+		return
+	}
+
+	switch err {
+	case nil:
+		if use > 0 {
+			tb.logTake(use, waited)
+		}
+	case errWaitTimeout, errWaitCanceled:
+		tb.logEvent("timeout", slog.Int64("count", need), slog.Duration("waited", waited))
+	}
+}
+
+// logRefill logs that count tokens are refilled by the daemon.
+func (tb *TokenBucket) logRefill(count int64) {
+	if tb.logEnabled() {
+		tb.logEvent("refill", slog.Int64("count", count))
+	}
+}
@@ -0,0 +1,110 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type captureHandler struct {
+	mutex   *sync.Mutex
+	level   slog.Level
+	records []string
+	// onHandle is called for every record, e.g. to use the bucket.
+	onHandle func()
+}
+
+func newCaptureHandler(level slog.Level) *captureHandler {
+	return &captureHandler{mutex: &sync.Mutex{}, level: level}
+}
+
+func (h *captureHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	if h.onHandle != nil {
+		h.onHandle()
+	}
+
+	fields := []string{r.Message}
+
+	r.Attrs(func(a slog.Attr) bool {
+		fields = append(fields, fmt.Sprintf("%s=%v", a.Key, a.Value))
+		return true
+	})
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.records = append(h.records, strings.Join(fields, " "))
+
+	return nil
+}
+
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *captureHandler) WithGroup(string) slog.Handler { return h }
+
+func (h *captureHandler) logged() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return append([]string(nil), h.records...)
+}
+
+func TestLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should log a take and then a timeout", func(t *testing.T) {
+		h := newCaptureHandler(slog.LevelDebug)
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 1, WithClock(c), WithLogger(slog.New(h)))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		// The logging would deadlock if the mutex was held.
+		h.onHandle = func() { b.Available() }
+
+		assert.True(b.TryTake(1))
+
+		done := make(chan bool)
+
+		go func() {
+			done <- b.TakeMaxDuration(1, time.Millisecond*500)
+		}()
+
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		c.Advance(time.Millisecond * 500)
+		assert.False(<-done)
+
+		c.Advance(time.Millisecond * 500)
+
+		assert.Equal([]string{
+			"take count=1 waited=0s avail=0",
+			"enqueue count=1 avail=0",
+			"timeout count=1 waited=500ms avail=0",
+			"refill count=1 avail=1",
+		}, h.logged())
+	})
+
+	t.Run("Should log nothing above debug level", func(t *testing.T) {
+		h := newCaptureHandler(slog.LevelInfo)
+		b, err := NewBucket(time.Minute, 1, WithLogger(slog.New(h)))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(1))
+		assert.False(b.TakeMaxDuration(1, time.Millisecond))
+		assert.Empty(h.logged())
+
+		_, err = NewBucket(time.Second, 1, WithLogger(nil))
+		assert.EqualError(err, "ratelimit: logger should not be nil")
+	})
+}
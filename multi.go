@@ -0,0 +1,25 @@
+package bucket
+
+// TakeReq is a request to take Count tokens from Bucket, see TakeAll.
+type TakeReq struct {
+	Bucket *TokenBucket
+	Count  int64
+}
+
+// TakeAll takes the tokens of every request if all of them can be taken right
+// now, e.g. when an operation is limited by several buckets like QPS and
+// bandwidth. Otherwise the tokens already taken are refunded so none of the
+// buckets is consumed, and it returns false. It never blocks.
+func TakeAll(reqs ...TakeReq) bool {
+	for i, req := range reqs {
+		if !req.Bucket.TryTake(req.Count) {
+			for _, taken := range reqs[:i] {
+				taken.Bucket.Refund(taken.Count)
+			}
+
+			return false
+		}
+	}
+
+	return true
+}
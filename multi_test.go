@@ -0,0 +1,41 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeAll(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should take the tokens from all the buckets", func(t *testing.T) {
+		b1 := New(time.Minute, 5)
+		defer b1.Destroy()
+
+		b2 := New(time.Minute, 100)
+		defer b2.Destroy()
+
+		assert.True(TakeAll(TakeReq{b1, 1}, TakeReq{b2, 50}))
+		assert.Equal(int64(4), b1.Available())
+		assert.Equal(int64(50), b2.Available())
+		assert.True(TakeAll())
+	})
+
+	t.Run("Should leave all the buckets untouched if any lacks tokens", func(t *testing.T) {
+		b1 := New(time.Minute, 5)
+		defer b1.Destroy()
+
+		b2 := New(time.Minute, 5)
+		defer b2.Destroy()
+
+		b3 := NewEmpty(time.Minute, 5)
+		defer b3.Destroy()
+
+		assert.False(TakeAll(TakeReq{b1, 2}, TakeReq{b2, 3}, TakeReq{b3, 1}))
+		assert.Equal(int64(5), b1.Available())
+		assert.Equal(int64(5), b2.Available())
+		assert.Equal(int64(0), b3.Available())
+	})
+}
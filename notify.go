@@ -0,0 +1,57 @@
+package bucket
+
+// OnEmpty registers fn to be called whenever the available tokens of the
+// bucket drop to zero, once per transition from having tokens to being empty.
+// fn is called without holding the inner mutexes, so it may use the bucket.
+// Passing nil removes the callback.
+func (tb *TokenBucket) OnEmpty(fn func()) {
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
+	tb.onEmpty = fn
+}
+
+// OnRefill registers fn to be called with the available tokens whenever the
+// bucket gets tokens again after being empty, so the consumers can resume
+// without polling. Like OnEmpty, fn is called without holding the inner
+// mutexes. Passing nil removes the callback.
+func (tb *TokenBucket) OnRefill(fn func(avail int64)) {
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
+	tb.onRefill = fn
+}
+
+// unlock releases tokenMutex and then calls the callbacks of the transition
+// happened while it was held.
+func (tb *TokenBucket) unlock() {
+	notify := tb.transition()
+
+	tb.tokenMutex.Unlock()
+
+	if notify != nil {
+		notify()
+	}
+}
+
+// transition tracks whether the bucket is empty and returns the callback to
+// call for a transition, it should be called with tokenMutex held.
+func (tb *TokenBucket) transition() func() {
+	avail := tb.loadAvail()
+
+	if avail <= 0 && !tb.empty {
+		tb.empty = true
+
+		return tb.onEmpty
+	}
+
+	if avail > 0 && tb.empty {
+		tb.empty = false
+
+		if fn := tb.onRefill; fn != nil {
+			return func() { fn(avail) }
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package bucket
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotify(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should call OnEmpty once per empty transition", func(t *testing.T) {
+		b := New(time.Minute, 2)
+		defer b.Destroy()
+
+		var calls int64
+
+		b.OnEmpty(func() {
+			atomic.AddInt64(&calls, 1)
+			// The callback is free to use the bucket.
+			b.Available()
+		})
+
+		assert.True(b.TryTake(1))
+		assert.Equal(int64(0), atomic.LoadInt64(&calls))
+
+		assert.True(b.TryTake(1))
+		assert.Equal(int64(1), atomic.LoadInt64(&calls))
+
+		assert.False(b.TryTake(1))
+		assert.Equal(int64(0), b.Drain())
+		assert.Equal(int64(1), atomic.LoadInt64(&calls))
+
+		b.AddTokens(2)
+		assert.Equal(int64(2), b.TryTakeN(2))
+		assert.Equal(int64(2), atomic.LoadInt64(&calls))
+	})
+
+	t.Run("Should not call OnEmpty for a bucket created empty", func(t *testing.T) {
+		b := NewEmpty(time.Minute, 2)
+		defer b.Destroy()
+
+		var calls int64
+
+		b.OnEmpty(func() { atomic.AddInt64(&calls, 1) })
+
+		assert.False(b.TryTake(1))
+		assert.Equal(int64(0), atomic.LoadInt64(&calls))
+	})
+
+	t.Run("Should call OnRefill once the daemon refills an empty bucket", func(t *testing.T) {
+		b := New(10*time.Millisecond, 2)
+		defer b.Destroy()
+
+		refilled := make(chan int64, 1)
+
+		b.OnRefill(func(avail int64) {
+			select {
+			case refilled <- avail:
+			default:
+			}
+		})
+
+		assert.Equal(int64(2), b.Drain())
+
+		select {
+		case avail := <-refilled:
+			assert.True(avail > 0)
+		case <-time.After(time.Second):
+			t.Fatal("OnRefill was not called")
+		}
+	})
+
+	t.Run("Should not call OnRefill when the bucket is not empty", func(t *testing.T) {
+		b := New(time.Minute, 2)
+		defer b.Destroy()
+
+		var calls int64
+
+		b.OnRefill(func(int64) { atomic.AddInt64(&calls, 1) })
+
+		assert.True(b.TryTake(1))
+		b.AddTokens(1)
+		assert.Equal(int64(0), atomic.LoadInt64(&calls))
+	})
+}
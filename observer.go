@@ -0,0 +1,56 @@
+package bucket
+
+import "time"
+
+// Observer receives the events of a bucket created WithObserver, so they can
+// be reported to any metrics backend. The methods are called without holding
+// the inner mutexes of the bucket.
+type Observer interface {
+	// OnTake is called when count tokens are taken after waiting for waited,
+	// which is zero for the methods which never wait like TryTake.
+	OnTake(count int64, waited time.Duration)
+	// OnReject is called when count tokens are not taken because there are
+	// not enough tokens for a TryTake like method, or because the bucket
+	// does not accept more waiters.
+	OnReject(count int64)
+	// OnTimeout is called when a wait for count tokens times out or is
+	// cancelled.
+	OnTimeout(count int64)
+}
+
+// observeTry reports a non-blocking take of count tokens which took taken
+// tokens.
+func (tb *TokenBucket) observeTry(count, taken int64) {
+	if taken > 0 {
+		tb.logTake(taken, 0)
+	}
+
+	if tb.observer == nil {
+		return
+	}
+
+	if taken > 0 {
+		tb.observer.OnTake(taken, 0)
+	} else if count > 0 {
+		tb.observer.OnReject(count)
+	}
+}
+
+// observeWait reports a wait for need tokens which took use tokens unless err
+// is not nil.
+func (tb *TokenBucket) observeWait(need, use int64, waited time.Duration, err error) {
+	if tb.observer == nil {
+		return
+	}
+
+	switch err {
+	case nil:
+		if use > 0 {
+			tb.observer.OnTake(use, waited)
+		}
+	case errWaitTimeout, errWaitCanceled:
+		tb.observer.OnTimeout(need)
+	case ErrTooManyWaiters, ErrBucketClosed:
+		tb.observer.OnReject(need)
+	}
+}
@@ -0,0 +1,94 @@
+package bucket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockObserver struct {
+	mutex  *sync.Mutex
+	events []string
+	waited []time.Duration
+}
+
+func newMockObserver() *mockObserver {
+	return &mockObserver{mutex: &sync.Mutex{}}
+}
+
+func (o *mockObserver) OnTake(count int64, waited time.Duration) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.events = append(o.events, fmt.Sprintf("take %d", count))
+	o.waited = append(o.waited, waited)
+}
+
+func (o *mockObserver) OnReject(count int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.events = append(o.events, fmt.Sprintf("reject %d", count))
+}
+
+func (o *mockObserver) OnTimeout(count int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.events = append(o.events, fmt.Sprintf("timeout %d", count))
+}
+
+func TestObserver(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should report takes, rejections and timeouts", func(t *testing.T) {
+		o := newMockObserver()
+		b, err := NewBucket(time.Millisecond*50, 3, WithObserver(o))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(2))
+		assert.False(b.TryTake(2))
+		assert.Equal(int64(1), b.TryTakeN(2))
+		assert.False(b.TakeMaxDuration(2, time.Millisecond*10))
+
+		b.Take(1)
+
+		assert.Equal([]string{"take 2", "reject 2", "take 1", "timeout 2", "take 1"}, o.events)
+		assert.Equal(time.Duration(0), o.waited[0])
+		assert.True(o.waited[2] > time.Millisecond*20)
+
+		_, err = NewBucket(time.Second, 1, WithObserver(nil))
+		assert.EqualError(err, "ratelimit: observer should not be nil")
+	})
+
+	t.Run("Should report the immediate takes of TakeTimed", func(t *testing.T) {
+		o := newMockObserver()
+		b, err := NewBucket(time.Minute, 2, WithObserver(o), WithClock(NewFakeClock(time.Unix(0, 0))))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		assert.Equal(time.Duration(0), b.TakeTimed(1))
+		b.Take(1)
+
+		assert.Equal([]string{"take 1", "take 1"}, o.events)
+		assert.Equal([]time.Duration{0, 0}, o.waited)
+	})
+
+	t.Run("Should report the rejected waiters", func(t *testing.T) {
+		o := newMockObserver()
+		b, err := NewBucket(time.Minute, 1, WithInitialTokens(0), WithMaxWaiters(1), WithObserver(o))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		go b.Take(1)
+
+		time.Sleep(time.Millisecond * 20)
+
+		assert.False(b.TakeOrReject(1))
+		assert.Equal([]string{"reject 1"}, o.events)
+	})
+}
@@ -0,0 +1,226 @@
+package bucket
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+// Option configures a token bucket created by NewBucket.
+type Option func(tb *TokenBucket) error
+
+// NewBucket returns a new token bucket with specified fill interval and
+// capability configured by opts, or an error if any of the arguments or
+// options is invalid. Without options the bucket behaves like the one
+// returned by New.
+func NewBucket(interval time.Duration, cap int64, opts ...Option) (*TokenBucket, error) {
+	tb, err := newTokenBucket(interval, cap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range opts {
+		if err := opt(tb); err != nil {
+			return nil, err
+		}
+	}
+
+	if tb.avail > tb.cap {
+		return nil, fmt.Errorf("ratelimit: initial tokens %v should not exceed"+
+			" capability %v", tb.avail, tb.cap)
+	}
+
+	if tb.lazy && tb.interval == 0 {
+		return nil, errors.New("ratelimit: interval of a lazy bucket should > 0")
+	}
+
+	if tb.lazy && tb.maxWaiters > 0 {
+		return nil, errors.New("ratelimit: lazy buckets have no waiting queue" +
+			" to limit")
+	}
+
+	if tb.lazy && tb.greedy {
+		return nil, errors.New("ratelimit: lazy buckets have no waiting queue" +
+			" to serve greedily")
+	}
+
+	tb.lastRefill = tb.clock.Now()
+	tb.empty = tb.avail == 0
+
+	if !tb.lazy {
+		tb.start()
+	}
+
+	return tb, nil
+}
+
+// WithInitialTokens makes the bucket start with n tokens instead of being
+// full, n should not exceed the capability of the bucket.
+func WithInitialTokens(n int64) Option {
+	return func(tb *TokenBucket) error {
+		if n < 0 {
+			return fmt.Errorf("ratelimit: initial tokens %v should not be negative", n)
+		}
+
+		tb.avail = n
+
+		return nil
+	}
+}
+
+// WithQuantum makes the bucket refill q tokens every interval instead of one.
+func WithQuantum(q int64) Option {
+	return func(tb *TokenBucket) error {
+		if q < 1 {
+			return fmt.Errorf("ratelimit: quantum %v should > 0", q)
+		}
+
+		tb.quantum = q
+
+		return nil
+	}
+}
+
+// WithClock makes the bucket get the time and its ticker from c, and also its
+// timers if c is a TimerClock. Together with WithRand and a FakeClock, the
+// bucket can be driven deterministically in tests.
+func WithClock(c Clock) Option {
+	return func(tb *TokenBucket) error {
+		if c == nil {
+			return errors.New("ratelimit: clock should not be nil")
+		}
+
+		tb.clock = c
+
+		return nil
+	}
+}
+
+// WithLazy makes the bucket compute its tokens lazily like the one returned
+// by NewLazy.
+func WithLazy() Option {
+	return func(tb *TokenBucket) error {
+		tb.lazy = true
+
+		return nil
+	}
+}
+
+// WithDrainWhilePaused makes the bucket still grant its available tokens
+// while it is paused by Pause, only the refilling is stopped.
+func WithDrainWhilePaused() Option {
+	return func(tb *TokenBucket) error {
+		tb.drainWhilePaused = true
+
+		return nil
+	}
+}
+
+// WithOverflowPolicy makes the bucket handle the tokens added beyond its
+// capability by AddTokens and Refund, or by their checked variants, with
+// policy instead of discarding them. Notice that with OverflowError only
+// AddTokensChecked and RefundChecked return ErrOverflow, AddTokens and Refund
+// still silently discard the tokens beyond the capability.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(tb *TokenBucket) error {
+		if policy.reserve < 0 {
+			return fmt.Errorf("ratelimit: spill reserve %v should not be negative", policy.reserve)
+		}
+
+		tb.overflow = policy
+
+		return nil
+	}
+}
+
+// WithObserver makes the bucket report its takes, rejections and timeouts to
+// o, see Observer.
+func WithObserver(o Observer) Option {
+	return func(tb *TokenBucket) error {
+		if o == nil {
+			return errors.New("ratelimit: observer should not be nil")
+		}
+
+		tb.observer = o
+
+		return nil
+	}
+}
+
+// WithLogger makes the bucket log its takes, enqueued waits, timeouts and
+// refills to l at debug level. The logging is done without holding the inner
+// mutexes of the bucket.
+func WithLogger(l *slog.Logger) Option {
+	return func(tb *TokenBucket) error {
+		if l == nil {
+			return errors.New("ratelimit: logger should not be nil")
+		}
+
+		tb.logger = l
+
+		return nil
+	}
+}
+
+// WithRandSource makes the bucket draw the jitter of TakeWithJitter from src
+// instead of the global source, e.g. to make it reproducible in tests.
+func WithRandSource(src rand.Source) Option {
+	return func(tb *TokenBucket) error {
+		if src == nil {
+			return errors.New("ratelimit: rand source should not be nil")
+		}
+
+		tb.rand = rand.New(src)
+
+		return nil
+	}
+}
+
+// WithRand makes the bucket draw the jitter of TakeWithJitter from r, like
+// WithRandSource. r should not be used elsewhere as it is not safe for
+// concurrent use.
+func WithRand(r *rand.Rand) Option {
+	return func(tb *TokenBucket) error {
+		if r == nil {
+			return errors.New("ratelimit: rand should not be nil")
+		}
+
+		tb.rand = r
+
+		return nil
+	}
+}
+
+// WithGreedyService makes the bucket serve the first waiting jobs whose tokens
+// are available, instead of serving them strictly in FIFO order where a job
+// needing many tokens holds back the smaller ones queued behind it. It keeps
+// the tokens flowing, but a large job may be starved by a steady stream of
+// small ones. It can not be used together with WithLazy.
+func WithGreedyService() Option {
+	return func(tb *TokenBucket) error {
+		tb.greedy = true
+
+		return nil
+	}
+}
+
+// WithMaxWaiters limits the waiting queue of the bucket to n goroutines, when
+// it is full TakeOrReject and TakeMaxDuration return false and TakeContext
+// returns ErrTooManyWaiters immediately without taking tokens. Take and the
+// other methods which can not report the rejection keep waiting until the
+// queue has room instead, so they are never let through unthrottled.
+// Zero means no limit. It can not be used together with WithLazy.
+func WithMaxWaiters(n int) Option {
+	return func(tb *TokenBucket) error {
+		if n < 0 {
+			return fmt.Errorf("ratelimit: max waiters %v should not be negative", n)
+		}
+
+		tb.maxWaiters = n
+
+		return nil
+	}
+}
@@ -0,0 +1,237 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should init the bucket like New without options", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 10)
+		assert.Nil(err)
+		defer b.Destory()
+
+		assert.Equal(int64(10), b.Capability())
+		assert.Equal(int64(10), b.Availible())
+	})
+
+	t.Run("Should return an error when interval or cap is invalid", func(t *testing.T) {
+		_, err := NewBucket(-time.Second, 10)
+		assert.NotNil(err)
+
+		_, err = NewBucket(time.Minute, -1)
+		assert.NotNil(err)
+	})
+
+	t.Run("Should init the bucket with initial tokens", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 10, WithInitialTokens(3))
+		assert.Nil(err)
+		defer b.Destory()
+
+		assert.Equal(int64(3), b.Availible())
+
+		_, err = NewBucket(time.Minute, 10, WithInitialTokens(-1))
+		assert.EqualError(err, "ratelimit: initial tokens -1 should not be negative")
+
+		_, err = NewBucket(time.Minute, 10, WithInitialTokens(11))
+		assert.EqualError(err, "ratelimit: initial tokens 11 should not exceed capability 10")
+	})
+
+	t.Run("Should refill quantum tokens every interval", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 10, WithInitialTokens(0), WithQuantum(4), WithClock(c))
+		assert.Nil(err)
+		defer b.Destory()
+
+		c.Advance(time.Second)
+		assert.Equal(int64(4), b.Availible())
+
+		c.Advance(time.Second)
+		c.Advance(time.Second)
+		assert.Equal(int64(10), b.Availible())
+
+		_, err = NewBucket(time.Second, 10, WithQuantum(0))
+		assert.EqualError(err, "ratelimit: quantum 0 should > 0")
+	})
+
+	t.Run("Should get the time from the clock", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 2, WithClock(c))
+		assert.Nil(err)
+		defer b.Destory()
+
+		assert.True(b.TryTake(2))
+
+		r := b.Reserve(1)
+		assert.Equal(time.Second, r.Delay())
+
+		c.Advance(time.Second)
+		assert.Equal(time.Duration(0), r.Delay())
+		assert.Equal(int64(0), b.Availible())
+
+		_, err = NewBucket(time.Second, 2, WithClock(nil))
+		assert.EqualError(err, "ratelimit: clock should not be nil")
+	})
+
+	t.Run("Should compute the tokens lazily with quantum and clock", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 10, WithLazy(), WithInitialTokens(0), WithQuantum(3), WithClock(c))
+		assert.Nil(err)
+
+		assert.Nil(b.ticker)
+
+		c.Advance(time.Second * 2)
+		assert.Equal(int64(6), b.Availible())
+
+		c.Advance(time.Second * 2)
+		assert.Equal(int64(10), b.Availible())
+	})
+
+	t.Run("Should reject new waiters when the waiting queue is full", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 2, WithInitialTokens(0), WithMaxWaiters(2))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		for i := 0; i < 2; i++ {
+			go b.Take(1)
+		}
+
+		time.Sleep(time.Millisecond * 50)
+		assert.Equal(2, b.WaitingCount())
+
+		assert.False(b.TakeOrReject(1))
+		assert.Equal(ErrTooManyWaiters, b.TakeContext(context.Background(), 1))
+		assert.Equal(2, b.WaitingCount())
+
+		b.AddTokens(1)
+		assert.Equal(1, b.WaitingCount())
+
+		done := make(chan bool)
+
+		go func() {
+			done <- b.TakeOrReject(1)
+		}()
+
+		time.Sleep(time.Millisecond * 50)
+		b.AddTokens(2)
+		assert.True(<-done)
+
+		_, err = NewBucket(time.Minute, 2, WithMaxWaiters(-1))
+		assert.EqualError(err, "ratelimit: max waiters -1 should not be negative")
+
+		_, err = NewBucket(time.Minute, 2, WithLazy(), WithMaxWaiters(1))
+		assert.EqualError(err, "ratelimit: lazy buckets have no waiting queue to limit")
+	})
+
+	t.Run("Should make Take wait for room in the full waiting queue", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 2, WithInitialTokens(0), WithMaxWaiters(1))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		go b.Take(1)
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+
+		done := make(chan struct{})
+
+		go func() {
+			b.Take(1)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 50)
+
+		select {
+		case <-done:
+			t.Fatal("Take returns without tokens when the queue is full")
+		default:
+		}
+
+		b.AddTokens(1)
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+		assert.Equal(int64(0), b.Available())
+
+		b.AddTokens(1)
+		<-done
+		assert.Equal(int64(0), b.Available())
+		assert.Equal(int64(2), b.TotalTaken())
+	})
+
+	t.Run("Should release Take waiting for room when destroyed", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 1, WithInitialTokens(0), WithMaxWaiters(1))
+		assert.Nil(err)
+
+		go b.Take(1)
+		waitUntil(func() bool { return b.WaitingCount() == 1 })
+
+		done := make(chan struct{})
+
+		go func() {
+			b.Take(1)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+		b.Destroy()
+		<-done
+	})
+
+	t.Run("Should return the refill rate per second", func(t *testing.T) {
+		b, err := NewBucket(time.Second, 1)
+		assert.Nil(err)
+		defer b.Destroy()
+
+		assert.Equal(float64(1), b.Rate())
+
+		b, err = NewBucket(time.Millisecond*100, 10, WithQuantum(10))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		assert.Equal(float64(100), b.Rate())
+	})
+
+	t.Run("Should hold small waiters behind a large one by default", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 3, WithInitialTokens(0))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		go b.Take(3)
+		time.Sleep(time.Millisecond * 20)
+		go b.Take(1)
+		time.Sleep(time.Millisecond * 20)
+
+		b.AddTokens(1)
+		assert.Equal(2, b.WaitingCount())
+		assert.Equal(int64(1), b.Available())
+
+		b.AddTokens(2)
+		assert.Equal(1, b.WaitingCount())
+		assert.Equal(int64(0), b.Available())
+	})
+
+	t.Run("Should serve the waiters which fit with WithGreedyService", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 3, WithInitialTokens(0), WithGreedyService())
+		assert.Nil(err)
+		defer b.Destroy()
+
+		go b.Take(3)
+		time.Sleep(time.Millisecond * 20)
+		go b.Take(1)
+		time.Sleep(time.Millisecond * 20)
+
+		b.AddTokens(1)
+		assert.Equal(1, b.WaitingCount())
+		assert.Equal(int64(0), b.Available())
+
+		b.AddTokens(3)
+		assert.Equal(0, b.WaitingCount())
+		assert.Equal(int64(0), b.Available())
+
+		_, err = NewBucket(time.Minute, 2, WithLazy(), WithGreedyService())
+		assert.EqualError(err, "ratelimit: lazy buckets have no waiting queue to serve greedily")
+	})
+}
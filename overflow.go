@@ -0,0 +1,96 @@
+package bucket
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrOverflow is returned by AddTokensChecked and RefundChecked of a bucket
+// created WithOverflowPolicy(OverflowError) when the tokens would exceed its
+// capability.
+var ErrOverflow = errors.New("token-bucket: tokens overflow the capability")
+
+// OverflowPolicy decides what happens to the tokens added beyond the
+// capability of a bucket by AddTokens or Refund, see WithOverflowPolicy.
+type OverflowPolicy struct {
+	rejects bool
+	reserve int64
+}
+
+var (
+	// OverflowClamp discards the tokens beyond the capability, which is the
+	// default.
+	OverflowClamp = OverflowPolicy{}
+	// OverflowError makes AddTokensChecked and RefundChecked return
+	// ErrOverflow without adding any token when the tokens would exceed the
+	// capability, e.g. to catch accounting bugs in billing style limiters.
+	// It does not change AddTokens and Refund, which return no error: they
+	// still silently discard the tokens beyond the capability like
+	// OverflowClamp, so only the checked variants report an overflow.
+	OverflowError = OverflowPolicy{rejects: true}
+)
+
+// OverflowSpill keeps up to reserve tokens beyond the capability aside, they
+// are put back into the bucket by the following refills as soon as there is
+// room for them.
+func OverflowSpill(reserve int64) OverflowPolicy {
+	return OverflowPolicy{reserve: reserve}
+}
+
+// addTokens adds count tokens and handles the overflow by the policy of the
+// bucket. If checked is true and the policy is OverflowError, it returns an
+// error wrapping ErrOverflow instead of adding the tokens. It should be called
+// with tokenMutex held.
+func (tb *TokenBucket) addTokens(count int64, checked bool) error {
+	for {
+		avail := tb.loadAvail()
+		n, over := count, int64(0)
+
+		if room := tb.roomFor(avail); uint64(n) > room {
+			n, over = int64(room), n-int64(room)
+		}
+
+		if over > 0 && checked && tb.overflow.rejects {
+			return fmt.Errorf("%w: adding %v tokens overflows bucket's capability %v",
+				ErrOverflow, count, tb.cap)
+		}
+
+		if atomic.CompareAndSwapInt64(&tb.avail, avail, avail+n) {
+			tb.spilled += over
+
+			if tb.spilled > tb.overflow.reserve {
+				tb.spilled = tb.overflow.reserve
+			}
+
+			return nil
+		}
+	}
+}
+
+// pourSpilled puts the spilled tokens back into the bucket as long as there is
+// room, it should be called with tokenMutex held.
+func (tb *TokenBucket) pourSpilled() {
+	if tb.spilled == 0 {
+		return
+	}
+
+	for {
+		avail := tb.loadAvail()
+		n := tb.spilled
+
+		if room := tb.roomFor(avail); uint64(n) > room {
+			n = int64(room)
+		}
+
+		if n <= 0 {
+			return
+		}
+
+		if atomic.CompareAndSwapInt64(&tb.avail, avail, avail+n) {
+			tb.spilled -= n
+
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package bucket
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverflowPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should clamp the tokens by default", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 5, WithOverflowPolicy(OverflowClamp))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		b.AddTokens(3)
+		assert.Equal(int64(5), b.Available())
+
+		assert.True(b.TryTake(5))
+		b.Refund(5)
+		assert.Equal(int64(5), b.Available())
+	})
+
+	t.Run("Should return ErrOverflow without adding tokens with OverflowError", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 5, WithOverflowPolicy(OverflowError))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(2))
+
+		assert.Nil(b.AddTokensChecked(2))
+		assert.Equal(int64(5), b.Available())
+
+		assert.True(b.TryTake(2))
+
+		err = b.RefundChecked(3)
+		assert.True(errors.Is(err, ErrOverflow))
+		assert.EqualError(err, "token-bucket: tokens overflow the capability:"+
+			" adding 3 tokens overflows bucket's capability 5")
+		assert.Equal(int64(3), b.Available())
+		assert.Equal(int64(0), b.TotalRefunded())
+
+		assert.Nil(b.RefundChecked(2))
+		assert.Equal(int64(5), b.Available())
+	})
+
+	t.Run("Should clamp without panicking in AddTokens and Refund with OverflowError", func(t *testing.T) {
+		b, err := NewBucket(time.Minute, 5, WithOverflowPolicy(OverflowError))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		b.Take(1)
+		b.Refund(1)
+		b.Refund(1)
+		b.AddTokens(3)
+
+		assert.Equal(int64(5), b.Available())
+	})
+
+	t.Run("Should spill the tokens into the reserve with OverflowSpill", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 5, WithClock(c), WithOverflowPolicy(OverflowSpill(2)))
+		assert.Nil(err)
+		defer b.Destroy()
+
+		b.AddTokens(3)
+		assert.Equal(int64(5), b.Available())
+
+		assert.True(b.TryTake(5))
+
+		c.Advance(time.Second)
+		assert.Equal(int64(3), b.Available())
+
+		c.Advance(time.Second)
+		assert.Equal(int64(4), b.Available())
+
+		_, err = NewBucket(time.Second, 5, WithOverflowPolicy(OverflowSpill(-1)))
+		assert.EqualError(err, "ratelimit: spill reserve -1 should not be negative")
+	})
+}
@@ -0,0 +1,46 @@
+package bucket
+
+import "sync/atomic"
+
+// Pause stops refilling the bucket, e.g. during an outage of the protected
+// service. A paused bucket grants no tokens at all, TryTake fails and the
+// waiters keep waiting until Resume is called, unless the bucket is created
+// WithDrainWhilePaused, in which case the available tokens can still be taken.
+func (tb *TokenBucket) Pause() {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.refill()
+
+	if !tb.isPaused() {
+		tb.resumed = make(chan struct{})
+	}
+
+	atomic.StoreInt32(&tb.paused, 1)
+}
+
+// Resume continues refilling a paused bucket and serves the waiters which
+// can be satisfied now. Time passed while paused does not refill the bucket.
+func (tb *TokenBucket) Resume() {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	if !tb.isPaused() {
+		return
+	}
+
+	atomic.StoreInt32(&tb.paused, 0)
+	close(tb.resumed)
+
+	tb.lastRefill = tb.clock.Now()
+	tb.serveWaitingJobs()
+}
+
+func (tb *TokenBucket) isPaused() bool {
+	return atomic.LoadInt32(&tb.paused) == 1
+}
+
+// granting returns whether tokens can be taken from the bucket now.
+func (tb *TokenBucket) granting() bool {
+	return tb.drainWhilePaused || !tb.isPaused()
+}
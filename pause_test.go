@@ -0,0 +1,122 @@
+package bucket
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPause(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should not refill or grant tokens while paused", func(t *testing.T) {
+		b := New(time.Millisecond*20, 2)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(1))
+
+		b.Pause()
+
+		assert.False(b.TryTake(1))
+		assert.Equal(int64(0), b.TryTakeN(1))
+
+		done := make(chan struct{})
+
+		go func() {
+			b.Take(2)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 80)
+		assert.Equal(int64(1), b.Available())
+
+		select {
+		case <-done:
+			t.Fatal("Take is served while paused")
+		default:
+		}
+
+		b.Resume()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Take is not served after Resume")
+		}
+	})
+
+	t.Run("Should not refill the lazy bucket for the paused time", func(t *testing.T) {
+		c := NewFakeClock(time.Unix(0, 0))
+		b, err := NewBucket(time.Second, 10, WithLazy(), WithInitialTokens(0), WithClock(c))
+		assert.Nil(err)
+
+		b.Pause()
+		c.Advance(time.Second * 5)
+		assert.Equal(int64(0), b.Available())
+
+		b.Resume()
+		c.Advance(time.Second * 2)
+		assert.Equal(int64(2), b.Available())
+	})
+
+	t.Run("Should not spin the waiters of a paused lazy bucket", func(t *testing.T) {
+		b, err := NewBucket(time.Millisecond*10, 1, WithLazy())
+		assert.Nil(err)
+
+		assert.True(b.TryTake(1))
+
+		b.Pause()
+
+		done := make(chan struct{})
+
+		go func() {
+			b.Take(1)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+
+		var before, after runtime.MemStats
+
+		runtime.ReadMemStats(&before)
+		time.Sleep(time.Millisecond * 100)
+		runtime.ReadMemStats(&after)
+
+		assert.True(after.Mallocs-before.Mallocs < 1000)
+
+		select {
+		case <-done:
+			t.Fatal("Take is served while paused")
+		default:
+		}
+
+		b.Resume()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Take is not served after Resume")
+		}
+	})
+
+	t.Run("Should drain the available tokens while paused with WithDrainWhilePaused", func(t *testing.T) {
+		b, err := NewBucket(time.Millisecond*20, 2, WithDrainWhilePaused())
+		assert.Nil(err)
+		defer b.Destroy()
+
+		b.Pause()
+
+		assert.True(b.TryTake(1))
+		assert.True(b.TryTake(1))
+		assert.False(b.TryTake(1))
+
+		time.Sleep(time.Millisecond * 60)
+		assert.Equal(int64(0), b.Available())
+
+		b.Resume()
+		time.Sleep(time.Millisecond * 60)
+		assert.True(b.Available() > 0)
+	})
+}
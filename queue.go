@@ -0,0 +1,123 @@
+package bucket
+
+// jobQueue is a FIFO queue of waiting jobs backed by a ring buffer, so unlike
+// container/list it allocates no node per waiter. A job removed from the
+// middle of the queue leaves a nil tombstone, which is skipped when it reaches
+// the front and dropped when the buffer is resized. It should be used with
+// waitingQuqueMutex held.
+type jobQueue struct {
+	jobs []*waitingJob
+	// head is the index of the front slot, and headSeq is the sequence number
+	// of the job pushed into it.
+	head    int
+	headSeq uint64
+	// size is the count of the slots in use including the tombstones, and
+	// live is the count of the jobs.
+	size int
+	live int
+}
+
+func newJobQueue() *jobQueue {
+	return &jobQueue{jobs: make([]*waitingJob, 8)}
+}
+
+// Len returns how many jobs are in the queue.
+func (q *jobQueue) Len() int {
+	return q.live
+}
+
+// PushBack appends w to the back of the queue.
+func (q *jobQueue) PushBack(w *waitingJob) {
+	if q.size == len(q.jobs) {
+		q.resize()
+	}
+
+	w.seq = q.headSeq + uint64(q.size)
+	w.queued = true
+	q.jobs[q.slot(q.size)] = w
+	q.size++
+	q.live++
+}
+
+// Front returns the job at the front of the queue, or nil if it is empty.
+func (q *jobQueue) Front() *waitingJob {
+	if q.live == 0 {
+		return nil
+	}
+
+	return q.jobs[q.head]
+}
+
+// Remove removes w from the queue, it does nothing if w is not queued.
+func (q *jobQueue) Remove(w *waitingJob) {
+	if !w.queued {
+		return
+	}
+
+	i := q.slot(int(w.seq - q.headSeq))
+
+	if q.jobs[i] != w {
+		return
+	}
+
+	q.jobs[i] = nil
+	w.queued = false
+	q.live--
+
+	// Keep a job or nothing at the front, so Front is O(1).
+	for q.size > 0 && q.jobs[q.head] == nil {
+		q.head = q.slot(1)
+		q.headSeq++
+		q.size--
+	}
+}
+
+// Each calls fn with the jobs from the front to the back until it returns
+// false.
+func (q *jobQueue) Each(fn func(w *waitingJob) bool) {
+	for i := 0; i < q.size; i++ {
+		if w := q.jobs[q.slot(i)]; w != nil && !fn(w) {
+			return
+		}
+	}
+}
+
+// Clear removes all the jobs from the queue.
+func (q *jobQueue) Clear() {
+	for i := 0; i < q.size; i++ {
+		if w := q.jobs[q.slot(i)]; w != nil {
+			w.queued = false
+			q.jobs[q.slot(i)] = nil
+		}
+	}
+
+	q.head, q.size, q.live = 0, 0, 0
+}
+
+// slot returns the index of the i-th slot from the front.
+func (q *jobQueue) slot(i int) int {
+	return (q.head + i) % len(q.jobs)
+}
+
+// resize moves the jobs to the start of a new buffer without the tombstones,
+// the buffer is doubled unless the tombstones free at least half of it.
+func (q *jobQueue) resize() {
+	n := len(q.jobs)
+
+	if q.live*2 > n {
+		n *= 2
+	}
+
+	jobs := make([]*waitingJob, n)
+	size := 0
+
+	q.Each(func(w *waitingJob) bool {
+		w.seq = q.headSeq + uint64(size)
+		jobs[size] = w
+		size++
+
+		return true
+	})
+
+	q.jobs, q.head, q.size = jobs, 0, size
+}
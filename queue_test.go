@@ -0,0 +1,138 @@
+package bucket
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should keep the jobs in FIFO order across resizes", func(t *testing.T) {
+		q := newJobQueue()
+		jobs := make([]*waitingJob, 20)
+
+		for i := range jobs {
+			jobs[i] = &waitingJob{need: int64(i)}
+			q.PushBack(jobs[i])
+		}
+
+		assert.Equal(20, q.Len())
+
+		for i := range jobs {
+			assert.Equal(jobs[i], q.Front())
+			q.Remove(q.Front())
+		}
+
+		assert.Equal(0, q.Len())
+		assert.Nil(q.Front())
+	})
+
+	t.Run("Should skip the removed jobs in the middle", func(t *testing.T) {
+		q := newJobQueue()
+		jobs := make([]*waitingJob, 4)
+
+		for i := range jobs {
+			jobs[i] = &waitingJob{need: int64(i)}
+			q.PushBack(jobs[i])
+		}
+
+		q.Remove(jobs[1])
+		q.Remove(jobs[1])
+		q.Remove(jobs[2])
+		assert.Equal(2, q.Len())
+
+		var needs []int64
+
+		q.Each(func(w *waitingJob) bool {
+			needs = append(needs, w.need)
+			return true
+		})
+
+		assert.Equal([]int64{0, 3}, needs)
+
+		q.Remove(jobs[0])
+		assert.Equal(jobs[3], q.Front())
+	})
+
+	t.Run("Should not grow when the tombstones can be dropped", func(t *testing.T) {
+		q := newJobQueue()
+		front := &waitingJob{}
+
+		q.PushBack(front)
+
+		for i := 0; i < 1000; i++ {
+			w := &waitingJob{}
+
+			q.PushBack(w)
+			q.Remove(w)
+		}
+
+		assert.Equal(1, q.Len())
+		assert.Equal(front, q.Front())
+		assert.Equal(8, len(q.jobs))
+	})
+
+	t.Run("Should clear all the jobs", func(t *testing.T) {
+		q := newJobQueue()
+		w := &waitingJob{}
+
+		q.PushBack(w)
+		q.PushBack(&waitingJob{})
+		q.Clear()
+
+		assert.Equal(0, q.Len())
+		assert.Nil(q.Front())
+		assert.False(w.queued)
+
+		q.Remove(w)
+		q.PushBack(w)
+		assert.Equal(w, q.Front())
+	})
+}
+
+func BenchmarkJobQueue(b *testing.B) {
+	q := newJobQueue()
+	jobs := make([]*waitingJob, 64)
+
+	for i := range jobs {
+		jobs[i] = &waitingJob{}
+	}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for _, w := range jobs {
+			q.PushBack(w)
+		}
+
+		for q.Len() > 0 {
+			q.Remove(q.Front())
+		}
+	}
+}
+
+// BenchmarkJobList is the container/list queue used before jobQueue, kept to
+// compare with BenchmarkJobQueue.
+func BenchmarkJobList(b *testing.B) {
+	l := list.New()
+	jobs := make([]*waitingJob, 64)
+
+	for i := range jobs {
+		jobs[i] = &waitingJob{}
+	}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for _, w := range jobs {
+			l.PushBack(w)
+		}
+
+		for l.Len() > 0 {
+			l.Remove(l.Front())
+		}
+	}
+}
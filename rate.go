@@ -0,0 +1,100 @@
+package bucket
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// minRateInterval is the shortest fill interval of a bucket created by
+// NewRate, higher rates add more tokens per tick instead of ticking faster.
+const minRateInterval = time.Millisecond * 10
+
+// NewRate returns a new token bucket refilled with rate tokens per second and
+// with specified capability. Unlike New, the rate needs not be a whole count
+// of tokens per interval, e.g. 2.5 tokens per second: the fractional tokens
+// are accrued and added to the bucket once they make a whole token. The
+// bucket is initially full. It panics if rate is not positive and finite, is
+// too low to fit its interval into a time.Duration, or the capability is
+// invalid.
+func NewRate(rate float64, cap int64) *TokenBucket {
+	if !(rate > 0) || math.IsInf(rate, 1) {
+		panic(fmt.Sprintf("ratelimit: rate %v should > 0", rate))
+	}
+
+	d := float64(time.Second) / rate
+
+	if d >= math.MaxInt64 {
+		panic(fmt.Sprintf("ratelimit: rate %v is too low", rate))
+	}
+
+	interval := time.Duration(d)
+
+	if interval < minRateInterval {
+		interval = minRateInterval
+	}
+
+	tb, err := newTokenBucket(interval, cap)
+
+	if err != nil {
+		panic(err.Error())
+	}
+
+	// The tokens per tick are derived from the rounded interval, so the
+	// average rate does not drift from rate.
+	tb.perTick = rate * interval.Seconds()
+	tb.start()
+
+	return tb
+}
+
+// NewTokenBucket returns a new token bucket which allows burst tokens to be
+// taken at once and is refilled with rate tokens per second, the common
+// "rate + burst" form of a limit. It is NewRate with whole tokens per second.
+// The bucket is initially full. It panics if rate is not positive or burst is
+// negative.
+func NewTokenBucket(rate, burst int64) *TokenBucket {
+	if rate <= 0 {
+		panic(fmt.Sprintf("ratelimit: rate %v should > 0", rate))
+	}
+
+	return NewRate(float64(rate), burst)
+}
+
+// addTicks adds the tokens refilled in ticks intervals, keeping the fraction
+// of a token accrued by a bucket created by NewRate for the next ticks. It
+// should be called with tokenMutex held.
+func (tb *TokenBucket) addTicks(ticks int64) {
+	if tb.perTick == 0 {
+		tb.addAvail(ticks, tb.quantum)
+		return
+	}
+
+	f := tb.fraction + float64(ticks)*tb.perTick
+	n := math.Floor(f)
+	tb.fraction = f - n
+
+	if n > float64(tb.cap) {
+		n = float64(tb.cap)
+	}
+
+	if n > 0 {
+		tb.addAvail(1, int64(n))
+	}
+}
+
+// ticksFor returns how many intervals it takes to refill count tokens, count
+// should be positive. It should be called with tokenMutex held.
+func (tb *TokenBucket) ticksFor(count int64) int64 {
+	if tb.perTick == 0 {
+		return (count-1)/tb.quantum + 1
+	}
+
+	ticks := math.Ceil((float64(count) - tb.fraction) / tb.perTick)
+
+	if ticks >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+
+	return int64(ticks)
+}
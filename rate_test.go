@@ -0,0 +1,110 @@
+package bucket
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRate(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should create a bucket with fractional rate", func(t *testing.T) {
+		b := NewRate(2.5, 5)
+		defer b.Destroy()
+
+		assert.Equal(time.Millisecond*400, b.Interval())
+		assert.InDelta(2.5, b.Rate(), 1e-9)
+		assert.Equal(int64(5), b.Available())
+
+		b = NewRate(250, 5)
+		defer b.Destroy()
+
+		assert.Equal(minRateInterval, b.Interval())
+		assert.InDelta(250, b.Rate(), 1e-9)
+	})
+
+	t.Run("Should panic when rate is invalid", func(t *testing.T) {
+		assert.Panics(func() { NewRate(0, 1) })
+		assert.Panics(func() { NewRate(-1, 1) })
+		assert.Panics(func() { NewRate(math.NaN(), 1) })
+		assert.Panics(func() { NewRate(math.Inf(1), 1) })
+		assert.Panics(func() { NewRate(1e-12, 1) })
+		assert.Panics(func() { NewRate(1, -1) })
+	})
+
+	t.Run("Should keep the fractional tokens between ticks", func(t *testing.T) {
+		b := NewRate(250, math.MaxInt64)
+		b.Destroy()
+
+		b.avail = 0
+
+		for i := 0; i < 1000; i++ {
+			b.addTicks(1)
+		}
+
+		assert.Equal(int64(2500), b.Available())
+		assert.Equal(int64(2500+25), b.AvailableAt(b.lastRefill.Add(minRateInterval*10)))
+	})
+
+	t.Run("Should grant tokens at the average rate", func(t *testing.T) {
+		b := NewRate(250, 5)
+		defer b.Destroy()
+
+		b.TakeAll()
+
+		var taken int64
+
+		deadline := time.Now().Add(time.Second * 2)
+
+		for time.Now().Before(deadline) {
+			taken += b.TakeAll()
+			time.Sleep(time.Millisecond * 5)
+		}
+
+		assert.InDelta(500, taken, 75)
+	})
+}
+
+func TestNewTokenBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should allow a burst and then throttle to the rate", func(t *testing.T) {
+		b := NewTokenBucket(100, 10)
+		defer b.Destroy()
+
+		assert.Equal(int64(10), b.Capability())
+		assert.InDelta(100, b.Rate(), 1e-9)
+
+		start := time.Now()
+
+		assert.True(b.TryTake(10))
+		assert.False(b.TryTake(1))
+
+		b.Take(5)
+
+		assert.True(time.Since(start) >= time.Millisecond*40)
+		assert.True(time.Since(start) < time.Millisecond*200)
+	})
+
+	t.Run("Should convert the rate to interval and tokens per tick", func(t *testing.T) {
+		b := NewTokenBucket(4, 1)
+		defer b.Destroy()
+
+		assert.Equal(time.Millisecond*250, b.Interval())
+		assert.Equal(float64(1), b.perTick)
+
+		b = NewTokenBucket(1000, 1)
+		defer b.Destroy()
+
+		assert.Equal(time.Millisecond*10, b.Interval())
+		assert.Equal(float64(10), b.perTick)
+	})
+
+	t.Run("Should panic when rate or burst is invalid", func(t *testing.T) {
+		assert.Panics(func() { NewTokenBucket(0, 1) })
+		assert.Panics(func() { NewTokenBucket(1, -1) })
+	})
+}
@@ -0,0 +1,53 @@
+package bucket
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	registryMutex   = &sync.Mutex{}
+	registryBuckets = make(map[string]*TokenBucket)
+)
+
+// Register creates a token bucket like New and registers it by name, so it
+// can be found with Lookup anywhere in the program instead of passing it
+// around. It panics if name is already registered, or if the interval or
+// capability is invalid.
+func Register(name string, interval time.Duration, cap int64) *TokenBucket {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, ok := registryBuckets[name]; ok {
+		panic(fmt.Sprintf("token-bucket: bucket %q is already registered", name))
+	}
+
+	tb := New(interval, cap)
+	registryBuckets[name] = tb
+
+	return tb
+}
+
+// Lookup returns the bucket registered by name, and whether it is found.
+func Lookup(name string) (*TokenBucket, bool) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	tb, ok := registryBuckets[name]
+
+	return tb, ok
+}
+
+// Unregister removes the bucket registered by name and destroys it. It does
+// nothing if name is not registered.
+func Unregister(name string) {
+	registryMutex.Lock()
+	tb, ok := registryBuckets[name]
+	delete(registryBuckets, name)
+	registryMutex.Unlock()
+
+	if ok {
+		tb.Destroy()
+	}
+}
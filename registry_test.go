@@ -0,0 +1,73 @@
+package bucket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should register, look up and unregister a bucket", func(t *testing.T) {
+		b := Register("registry-test", time.Minute, 2)
+
+		found, ok := Lookup("registry-test")
+		assert.True(ok)
+		assert.Equal(b, found)
+
+		assert.Panics(func() { Register("registry-test", time.Minute, 2) })
+
+		Unregister("registry-test")
+		Unregister("registry-test")
+
+		_, ok = Lookup("registry-test")
+		assert.False(ok)
+		assert.False(b.Healthy())
+
+		b = Register("registry-test", time.Minute, 3)
+		defer Unregister("registry-test")
+
+		assert.Equal(int64(3), b.Capability())
+		assert.Panics(func() { Register("registry-invalid", time.Minute, -1) })
+	})
+
+	t.Run("Should be safe to use under concurrency", func(t *testing.T) {
+		wg := &sync.WaitGroup{}
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				name := fmt.Sprintf("registry-concurrent-%d", i%5)
+
+				if b, ok := Lookup(name); ok {
+					b.TryTake(1)
+				}
+
+				func() {
+					defer func() { recover() }()
+					Register(name, time.Minute, 1)
+				}()
+
+				Lookup(name)
+			}(i)
+		}
+
+		wg.Wait()
+
+		for i := 0; i < 5; i++ {
+			name := fmt.Sprintf("registry-concurrent-%d", i)
+
+			_, ok := Lookup(name)
+			assert.True(ok)
+
+			Unregister(name)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package bucket
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Reservation holds tokens taken from a bucket ahead of time by Reserve.
+type Reservation struct {
+	tb       *TokenBucket
+	count    int64
+	at       time.Time
+	canceled bool
+	parent   *Reservation
+	ctx      context.Context
+}
+
+// Reserve takes count tokens from the bucket without blocking and returns a
+// Reservation telling how long the caller should wait before acting as if the
+// tokens were available. Until the reserved tokens are refilled the available
+// tokens of the bucket can be negative, so the following takers will wait for
+// them too. It panics if count is negative or greater than the capability of
+// the bucket, as such a reservation could never be satisfied.
+func (tb *TokenBucket) Reserve(count int64) *Reservation {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.checkCount(count)
+	tb.refill()
+
+	r := &Reservation{
+		tb:    tb,
+		count: count,
+		at:    tb.clock.Now(),
+		ctx:   context.Background(),
+	}
+
+	if avail := atomic.AddInt64(&tb.avail, -count); avail < 0 {
+		r.at = tb.refillTime(-avail)
+	}
+
+	atomic.AddInt64(&tb.taken, count)
+
+	if tb.parent != nil {
+		r.parent = tb.parent.Reserve(count)
+	}
+
+	return r
+}
+
+// ReserveContext reserves count tokens like Reserve, and the returned
+// Reservation's Wait honors ctx. It returns ctx.Err() without reserving any
+// token if ctx is already done.
+func (tb *TokenBucket) ReserveContext(ctx context.Context, count int64) (*Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r := tb.Reserve(count)
+	r.ctx = ctx
+
+	return r, nil
+}
+
+// TryReserve reserves count tokens like Reserve only if they are available
+// right now, so the returned Reservation has no delay. Otherwise it returns
+// false without taking any token, unlike Reserve which borrows the tokens to
+// be refilled.
+func (tb *TokenBucket) TryReserve(count int64) (*Reservation, bool) {
+	if !tb.tryTake(count, count) {
+		return nil, false
+	}
+
+	return tb.reserved(count), true
+}
+
+// reserved returns a Reservation of count tokens already taken from the bucket
+// and its ancestors.
+func (tb *TokenBucket) reserved(count int64) *Reservation {
+	r := &Reservation{
+		tb:    tb,
+		count: count,
+		at:    tb.clock.Now(),
+		ctx:   context.Background(),
+	}
+
+	if tb.parent != nil {
+		r.parent = tb.parent.reserved(count)
+	}
+
+	return r
+}
+
+// Wait blocks for Delay until the reserved tokens are available. If the
+// context given to ReserveContext is done first, the reservation is canceled
+// and the error of the context is returned. It returns ErrBucketDestroyed if
+// the bucket is destroyed while waiting.
+func (r *Reservation) Wait() error {
+	d := r.Delay()
+
+	if d == 0 {
+		return nil
+	}
+
+	timer := r.tb.newTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-r.ctx.Done():
+		r.Cancel()
+		return r.ctx.Err()
+	case <-r.tb.done:
+		return ErrBucketDestroyed
+	}
+}
+
+// Delay returns how long the caller should wait until the reserved tokens
+// are available, zero means they are available now.
+func (r *Reservation) Delay() time.Duration {
+	d := r.at.Sub(r.tb.clock.Now())
+
+	if r.parent != nil {
+		if pd := r.parent.Delay(); pd > d {
+			d = pd
+		}
+	}
+
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+// Cancel gives the reserved tokens back to the bucket and its parent. It
+// should only be called when the reserved tokens are not going to be used,
+// calling it more than once has no further effect.
+func (r *Reservation) Cancel() {
+	r.tb.tokenMutex.Lock()
+
+	if r.canceled {
+		r.tb.tokenMutex.Unlock()
+		return
+	}
+
+	r.canceled = true
+	r.tb.tokenMutex.Unlock()
+
+	r.tb.AddTokens(r.count)
+	atomic.AddInt64(&r.tb.refunded, r.count)
+
+	if r.parent != nil {
+		r.parent.Cancel()
+	}
+}
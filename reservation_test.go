@@ -0,0 +1,152 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservation(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should reserve available tokens without delay", func(t *testing.T) {
+		b := New(time.Minute, 5)
+		defer b.Destory()
+
+		r := b.Reserve(3)
+
+		assert.Equal(time.Duration(0), r.Delay())
+		assert.Equal(int64(2), b.Availible())
+	})
+
+	t.Run("Should report the delay until reserved tokens are available", func(t *testing.T) {
+		b := New(time.Second, 2)
+		defer b.Destory()
+
+		assert.True(b.TryTake(1))
+
+		r := b.Reserve(2)
+
+		assert.True(r.Delay() > 0)
+		assert.True(r.Delay() <= time.Second)
+		assert.Equal(int64(-1), b.Availible())
+		assert.False(b.TryTake(1))
+	})
+
+	t.Run("Should give back the reserved tokens when canceled", func(t *testing.T) {
+		b := New(time.Minute, 2)
+		defer b.Destory()
+
+		assert.True(b.TryTake(1))
+
+		r := b.Reserve(2)
+		r.Cancel()
+		r.Cancel()
+
+		assert.Equal(int64(1), b.Availible())
+	})
+
+	t.Run("Should panic when count is greater than cap", func(t *testing.T) {
+		b := New(time.Minute, 2)
+		defer b.Destory()
+
+		assert.Panics(func() { b.Reserve(3) })
+		assert.Panics(func() { b.Reserve(-1) })
+	})
+
+	t.Run("Should reserve tokens from a lazy bucket", func(t *testing.T) {
+		b := NewLazy(time.Millisecond*100, 1)
+
+		assert.True(b.TryTake(1))
+
+		r := b.Reserve(1)
+
+		assert.True(r.Delay() > 0)
+
+		time.Sleep(r.Delay())
+
+		assert.Equal(int64(0), b.Availible())
+	})
+
+	t.Run("Should wait for the reserved tokens with ReserveContext", func(t *testing.T) {
+		b := New(time.Millisecond*50, 1)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(1))
+
+		r, err := b.ReserveContext(context.Background(), 1)
+		assert.Nil(err)
+
+		start := time.Now()
+
+		assert.Nil(r.Wait())
+		assert.True(time.Since(start) > time.Millisecond*20)
+		assert.Equal(time.Duration(0), r.Delay())
+	})
+
+	t.Run("Should cancel the reservation when the context is done", func(t *testing.T) {
+		b := New(time.Minute, 1)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+
+		r, err := b.ReserveContext(ctx, 1)
+		assert.Nil(err)
+		assert.Equal(int64(-1), b.Available())
+
+		assert.Equal(context.DeadlineExceeded, r.Wait())
+		assert.Equal(int64(0), b.Available())
+	})
+
+	t.Run("Should reserve available tokens with TryReserve", func(t *testing.T) {
+		parent := New(time.Minute, 5)
+		defer parent.Destroy()
+
+		b := NewChild(parent, time.Minute, 3)
+		defer b.Destroy()
+
+		r, ok := b.TryReserve(2)
+		assert.True(ok)
+		assert.Equal(time.Duration(0), r.Delay())
+		assert.Nil(r.Wait())
+		assert.Equal(int64(1), b.Available())
+		assert.Equal(int64(3), parent.Available())
+
+		r.Cancel()
+		assert.Equal(int64(3), b.Available())
+		assert.Equal(int64(5), parent.Available())
+
+		assert.Panics(func() { b.TryReserve(4) })
+	})
+
+	t.Run("Should refuse to reserve future tokens with TryReserve", func(t *testing.T) {
+		b := New(time.Second, 2)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(1))
+
+		r, ok := b.TryReserve(2)
+		assert.False(ok)
+		assert.Nil(r)
+		assert.Equal(int64(1), b.Available())
+		assert.True(b.TryTake(1))
+	})
+
+	t.Run("Should not reserve with a done context", func(t *testing.T) {
+		b := New(time.Minute, 1)
+		defer b.Destroy()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		r, err := b.ReserveContext(ctx, 1)
+		assert.Nil(r)
+		assert.Equal(context.Canceled, err)
+		assert.Equal(int64(1), b.Available())
+	})
+}
@@ -0,0 +1,136 @@
+package bucket
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ShardedBucket is a single logical limit split across several independent
+// token buckets, so callers taking tokens concurrently contend on different
+// mutexes instead of one. It is safe to use under concurrency environments.
+//
+// Sharding trades accuracy and fairness for throughput: the calls are routed
+// to the shards round-robin, a Take waits on its own shard even if another
+// shard has tokens, and the waiters of different shards are not served in
+// order. The aggregate capability matches the unsharded limit, but every
+// shard refills all of its share each interval, so together they refill about
+// cap tokens per interval rather than one like New. A single call can take at
+// most the capability of one shard.
+type ShardedBucket struct {
+	next   uint64
+	shards []*TokenBucket
+}
+
+// NewSharded returns a new ShardedBucket whose capability cap is partitioned
+// across shards buckets, each refilled with all of its capability every
+// interval, so the aggregate rate is about cap tokens per interval. The
+// buckets are initially full. It panics if shards is not positive or cap is
+// less than shards.
+func NewSharded(interval time.Duration, cap, shards int64) *ShardedBucket {
+	if shards <= 0 {
+		panic(fmt.Sprintf("ratelimit: shards %v should > 0", shards))
+	}
+
+	if cap < shards {
+		panic(fmt.Sprintf("ratelimit: capability %v should not be less than"+
+			" shards %v", cap, shards))
+	}
+
+	sb := &ShardedBucket{shards: make([]*TokenBucket, shards)}
+
+	for i := range sb.shards {
+		// The remainder goes to the first shards.
+		c := cap / shards
+
+		if int64(i) < cap%shards {
+			c++
+		}
+
+		tb, err := NewBucket(interval, c, WithQuantum(c))
+
+		if err != nil {
+			sb.Destroy()
+			panic(err.Error())
+		}
+
+		sb.shards[i] = tb
+	}
+
+	return sb
+}
+
+// TryTake trys to task specified count tokens from the shard in turn, or from
+// any other shard which has enough tokens. It returns true if it succeeds. It
+// panics if count is greater than the capability of the shards.
+func (sb *ShardedBucket) TryTake(count int64) bool {
+	sb.checkCount(count)
+
+	i := sb.pick()
+
+	for n := 0; n < len(sb.shards); n++ {
+		if sb.shards[(i+n)%len(sb.shards)].TryTake(count) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Take takes specified count tokens from the shard in turn, waiting until
+// they are available in that shard. It panics if count is greater than the
+// capability of the shards.
+func (sb *ShardedBucket) Take(count int64) {
+	sb.checkCount(count)
+
+	sb.shards[sb.pick()].Take(count)
+}
+
+// Available returns how many tokens are available in all the shards.
+func (sb *ShardedBucket) Available() int64 {
+	var avail int64
+
+	for _, tb := range sb.shards {
+		avail += tb.Available()
+	}
+
+	return avail
+}
+
+// Capability returns the capability of all the shards.
+func (sb *ShardedBucket) Capability() int64 {
+	var cap int64
+
+	for _, tb := range sb.shards {
+		cap += tb.Capability()
+	}
+
+	return cap
+}
+
+// Shards returns how many shards the limit is split across.
+func (sb *ShardedBucket) Shards() int {
+	return len(sb.shards)
+}
+
+// Destroy destroys all the shards.
+func (sb *ShardedBucket) Destroy() {
+	for _, tb := range sb.shards {
+		if tb != nil {
+			tb.Destroy()
+		}
+	}
+}
+
+// pick returns the index of the shard in turn.
+func (sb *ShardedBucket) pick() int {
+	return int((atomic.AddUint64(&sb.next, 1) - 1) % uint64(len(sb.shards)))
+}
+
+// checkCount panics if count can not be taken from every shard, the last
+// shard has the least capability.
+func (sb *ShardedBucket) checkCount(count int64) {
+	if err := sb.shards[len(sb.shards)-1].countError(count); err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,91 @@
+package bucket
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should partition the capability across the shards", func(t *testing.T) {
+		sb := NewSharded(time.Minute, 10, 3)
+		defer sb.Destroy()
+
+		assert.Equal(3, sb.Shards())
+		assert.Equal(int64(10), sb.Capability())
+		assert.Equal(int64(4), sb.shards[0].Capability())
+		assert.Equal(int64(3), sb.shards[2].Capability())
+
+		for i := 0; i < 10; i++ {
+			assert.True(sb.TryTake(1))
+		}
+
+		assert.False(sb.TryTake(1))
+		assert.Equal(int64(0), sb.Available())
+	})
+
+	t.Run("Should take from the shard in turn", func(t *testing.T) {
+		sb := NewSharded(time.Minute, 4, 2)
+		defer sb.Destroy()
+
+		sb.Take(2)
+		assert.Equal(int64(0), sb.shards[0].Available())
+		assert.Equal(int64(2), sb.shards[1].Available())
+
+		assert.True(sb.TryTake(2))
+		assert.Equal(int64(0), sb.Available())
+	})
+
+	t.Run("Should keep the aggregate rate", func(t *testing.T) {
+		sb := NewSharded(time.Millisecond*100, 40, 4)
+		defer sb.Destroy()
+
+		for sb.TryTake(1) {
+		}
+
+		var taken int64
+
+		deadline := time.Now().Add(time.Second)
+
+		for time.Now().Before(deadline) {
+			for sb.TryTake(1) {
+				taken++
+			}
+
+			time.Sleep(time.Millisecond * 5)
+		}
+
+		assert.InDelta(400, taken, 60)
+	})
+
+	t.Run("Should panic when arguments are invalid", func(t *testing.T) {
+		assert.Panics(func() { NewSharded(time.Second, 10, 0) })
+		assert.Panics(func() { NewSharded(time.Second, 2, 3) })
+		assert.Panics(func() { NewSharded(-time.Second, 10, 2) })
+
+		sb := NewSharded(time.Second, 10, 3)
+		defer sb.Destroy()
+
+		assert.Panics(func() { sb.TryTake(4) })
+		assert.Panics(func() { sb.Take(-1) })
+	})
+}
+
+func BenchmarkShardedTryTakeContended(b *testing.B) {
+	sb := NewSharded(time.Minute, math.MaxInt64, int64(runtime.GOMAXPROCS(0)))
+	defer sb.Destroy()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sb.TryTake(1)
+		}
+	})
+}
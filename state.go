@@ -0,0 +1,141 @@
+package bucket
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BucketState is the state of a token bucket, which can be saved with
+// Snapshot and restored with RestoreBucket, e.g. across restarts.
+type BucketState struct {
+	Interval time.Duration
+	Cap      int64
+	Avail    int64
+}
+
+// bucketStateGobVersion is the first byte of a gob encoded BucketState.
+const bucketStateGobVersion = 1
+
+// Snapshot returns the current state of the bucket.
+func (tb *TokenBucket) Snapshot() BucketState {
+	tb.tokenMutex.Lock()
+	defer tb.unlock()
+
+	tb.refill()
+
+	return BucketState{
+		Interval: tb.interval,
+		Cap:      tb.cap,
+		Avail:    tb.loadAvail(),
+	}
+}
+
+// RestoreBucket returns a new token bucket restored from state, which starts
+// refilling from the saved available tokens. The available tokens are clamped
+// between zero and the capability. It panics if the interval or capability is
+// invalid like New.
+func RestoreBucket(state BucketState) *TokenBucket {
+	tb, err := newTokenBucket(state.Interval, state.Cap)
+
+	if err != nil {
+		panic(err.Error())
+	}
+
+	switch {
+	case state.Avail < 0:
+		tb.avail = 0
+	case state.Avail < tb.cap:
+		tb.avail = state.Avail
+	}
+
+	tb.empty = tb.avail <= 0
+
+	tb.start()
+
+	return tb
+}
+
+type bucketStateJSON struct {
+	Interval string `json:"interval"`
+	Cap      int64  `json:"cap"`
+	Avail    int64  `json:"avail"`
+}
+
+// MarshalJSON implements json.Marshaler, the interval is encoded as a
+// duration string like "1s".
+func (s BucketState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bucketStateJSON{
+		Interval: s.Interval.String(),
+		Cap:      s.Cap,
+		Avail:    s.Avail,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, the interval should be a
+// duration string accepted by time.ParseDuration.
+func (s *BucketState) UnmarshalJSON(data []byte) error {
+	var v bucketStateJSON
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	interval, err := time.ParseDuration(v.Interval)
+
+	if err != nil {
+		return fmt.Errorf("token-bucket: invalid interval %q: %v", v.Interval, err)
+	}
+
+	s.Interval = interval
+	s.Cap = v.Cap
+	s.Avail = v.Avail
+
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder, so the state can be sent to other
+// instances over a gob stream. Only the state is transferred, the receiver
+// has to create its own live bucket with RestoreBucket.
+func (s BucketState) GobEncode() ([]byte, error) {
+	buf := make([]byte, 1, 1+3*binary.MaxVarintLen64)
+	buf[0] = bucketStateGobVersion
+
+	for _, v := range []int64{int64(s.Interval), s.Cap, s.Avail} {
+		var b [binary.MaxVarintLen64]byte
+
+		buf = append(buf, b[:binary.PutVarint(b[:], v)]...)
+	}
+
+	return buf, nil
+}
+
+// GobDecode implements gob.GobDecoder.
+func (s *BucketState) GobDecode(data []byte) error {
+	if len(data) == 0 || data[0] != bucketStateGobVersion {
+		return errors.New("token-bucket: unsupported gob state version")
+	}
+
+	r := bytes.NewReader(data[1:])
+
+	var v [3]int64
+
+	for i := range v {
+		n, err := binary.ReadVarint(r)
+
+		if err != nil {
+			return fmt.Errorf("token-bucket: invalid gob state: %v", err)
+		}
+
+		v[i] = n
+	}
+
+	s.Interval = time.Duration(v[0])
+	s.Cap = v[1]
+	s.Avail = v[2]
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package bucket
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketState(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should restore the bucket from a snapshot", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destroy()
+
+		assert.True(b.TryTake(4))
+
+		state := b.Snapshot()
+
+		assert.Equal(BucketState{Interval: time.Minute, Cap: 10, Avail: 6}, state)
+
+		restored := RestoreBucket(state)
+		defer restored.Destroy()
+
+		assert.Equal(b.Available(), restored.Available())
+		assert.Equal(b.Capability(), restored.Capability())
+	})
+
+	t.Run("Should refill the restored bucket", func(t *testing.T) {
+		b := RestoreBucket(BucketState{Interval: time.Millisecond * 50, Cap: 2, Avail: 0})
+		defer b.Destroy()
+
+		assert.Equal(int64(0), b.Available())
+
+		time.Sleep(time.Millisecond * 80)
+
+		assert.Equal(int64(1), b.Available())
+	})
+
+	t.Run("Should clamp the restored tokens to the capability", func(t *testing.T) {
+		b := RestoreBucket(BucketState{Interval: time.Minute, Cap: 2, Avail: 5})
+		defer b.Destroy()
+
+		assert.Equal(int64(2), b.Available())
+
+		b = RestoreBucket(BucketState{Interval: time.Minute, Cap: 10, Avail: -5})
+		defer b.Destroy()
+
+		assert.Equal(int64(0), b.Available())
+	})
+
+	t.Run("Should panic when the state is invalid", func(t *testing.T) {
+		assert.Panics(func() { RestoreBucket(BucketState{Interval: -time.Second, Cap: 2}) })
+		assert.Panics(func() { RestoreBucket(BucketState{Interval: time.Second, Cap: -1}) })
+	})
+
+	t.Run("Should marshal the state to JSON with a duration string", func(t *testing.T) {
+		data, err := json.Marshal(BucketState{Interval: time.Second, Cap: 1000, Avail: 432})
+
+		assert.Nil(err)
+		assert.Equal(`{"interval":"1s","cap":1000,"avail":432}`, string(data))
+	})
+
+	t.Run("Should round trip the state through JSON", func(t *testing.T) {
+		state := BucketState{Interval: time.Millisecond * 1500, Cap: 10, Avail: 3}
+
+		data, err := json.Marshal(state)
+		assert.Nil(err)
+
+		var decoded BucketState
+
+		assert.Nil(json.Unmarshal(data, &decoded))
+		assert.Equal(state, decoded)
+	})
+
+	t.Run("Should reject malformed duration strings", func(t *testing.T) {
+		var state BucketState
+
+		assert.NotNil(json.Unmarshal([]byte(`{"interval":"1 second","cap":1,"avail":1}`), &state))
+		assert.NotNil(json.Unmarshal([]byte(`{"interval":1000,"cap":1,"avail":1}`), &state))
+	})
+
+	t.Run("Should round trip the state through gob", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destroy()
+
+		b.TryTake(4)
+
+		var buf bytes.Buffer
+
+		assert.Nil(gob.NewEncoder(&buf).Encode(b.Snapshot()))
+
+		var decoded BucketState
+
+		assert.Nil(gob.NewDecoder(&buf).Decode(&decoded))
+		assert.Equal(BucketState{Interval: time.Minute, Cap: 10, Avail: 6}, decoded)
+	})
+
+	t.Run("Should reject malformed gob state", func(t *testing.T) {
+		var state BucketState
+
+		assert.EqualError(state.GobDecode(nil), "token-bucket: unsupported gob state version")
+		assert.NotNil(state.GobDecode([]byte{1, 0x80}))
+	})
+}
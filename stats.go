@@ -0,0 +1,69 @@
+package bucket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds the statistics of a token bucket since it was created.
+type Stats struct {
+	// Taken is the total count of tokens taken from the bucket, see
+	// TotalTaken.
+	Taken int64
+	// Waits is how many times a caller had to wait for tokens.
+	Waits int64
+	// Timeouts is how many waits were given up because of a timeout or a
+	// cancellation.
+	Timeouts int64
+	// Waiting is how many jobs are waiting for tokens now.
+	Waiting int
+	// WaitTime is the cumulative time spent waiting by all callers.
+	WaitTime time.Duration
+}
+
+// Stats returns the statistics of the bucket.
+func (tb *TokenBucket) Stats() Stats {
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
+	tb.waitingQuqueMutex.Lock()
+	defer tb.waitingQuqueMutex.Unlock()
+
+	return Stats{
+		Taken:    atomic.LoadInt64(&tb.taken),
+		Waits:    tb.waits,
+		Timeouts: tb.timeouts,
+		Waiting:  tb.waitingLen(),
+		WaitTime: tb.waitTime,
+	}
+}
+
+// TotalTaken returns how many tokens are taken from the bucket since it was
+// created, by any of the take methods and the wrappers using them. It only
+// reads an atomic counter, so it is cheap and does not contend with the
+// takers. The count never decreases, the tokens given back are counted by
+// TotalRefunded instead.
+func (tb *TokenBucket) TotalTaken() int64 {
+	return atomic.LoadInt64(&tb.taken)
+}
+
+// TotalRefunded returns how many tokens are given back to the bucket since it
+// was created by Refund or by canceling a Reservation, so TotalTaken minus
+// TotalRefunded is the net usage of the bucket. Like TotalTaken, it is cheap
+// and never decreases.
+func (tb *TokenBucket) TotalRefunded() int64 {
+	return atomic.LoadInt64(&tb.refunded)
+}
+
+// finishWait records a wait which started at start and ended with err.
+func (tb *TokenBucket) finishWait(start time.Time, err error) {
+	tb.tokenMutex.Lock()
+	defer tb.tokenMutex.Unlock()
+
+	tb.waits++
+	tb.waitTime += tb.clock.Now().Sub(start)
+
+	if err == errWaitTimeout || err == errWaitCanceled {
+		tb.timeouts++
+	}
+}
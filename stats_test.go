@@ -0,0 +1,97 @@
+package bucket
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should init with empty stats", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destory()
+
+		assert.Equal(Stats{}, b.Stats())
+	})
+
+	t.Run("Should count takes, waits and timeouts", func(t *testing.T) {
+		b := New(time.Millisecond*100, 2)
+		defer b.Destory()
+
+		assert.True(b.TryTake(2))
+		assert.False(b.TryTake(1))
+		b.Take(1)
+		assert.False(b.TakeMaxDuration(2, time.Millisecond*50))
+		b.Wait(1)
+
+		stats := b.Stats()
+
+		assert.Equal(int64(3), stats.Taken)
+		assert.Equal(int64(3), stats.Waits)
+		assert.Equal(int64(1), stats.Timeouts)
+		assert.Equal(0, stats.Waiting)
+		assert.True(stats.WaitTime >= time.Millisecond*150)
+	})
+
+	t.Run("Should count the waiting jobs", func(t *testing.T) {
+		b := New(time.Minute, 1)
+
+		assert.True(b.TryTake(1))
+
+		go b.Take(1)
+		go b.Take(1)
+
+		time.Sleep(time.Millisecond * 50)
+
+		assert.Equal(2, b.Stats().Waiting)
+
+		b.Destory()
+	})
+
+	t.Run("Should count the total taken tokens", func(t *testing.T) {
+		b := New(time.Millisecond*10, 4)
+		defer b.Destroy()
+
+		assert.Equal(int64(0), b.TotalTaken())
+
+		b.Refund(1)
+		assert.Equal(int64(0), b.TotalTaken())
+		assert.Equal(int64(1), b.TotalRefunded())
+
+		assert.True(b.TryTake(3))
+		assert.Equal(int64(1), b.TryTakeN(2))
+		assert.False(b.TryTake(1))
+		b.Take(2)
+
+		w := NewWriter(&bytes.Buffer{}, b)
+		n, err := w.Write(make([]byte, 6))
+		assert.Nil(err)
+		assert.Equal(6, n)
+
+		r := b.Reserve(1)
+		r.Cancel()
+
+		b.Take(1)
+		b.Refund(1)
+
+		assert.Equal(int64(3+1+2+6+1+1), b.TotalTaken())
+		assert.Equal(int64(1+1+1), b.TotalRefunded())
+		assert.Equal(b.Stats().Taken, b.TotalTaken())
+	})
+
+	t.Run("Should count takes of a lazy bucket", func(t *testing.T) {
+		b := NewLazy(time.Millisecond*50, 1)
+
+		b.Take(1)
+		b.Take(1)
+
+		stats := b.Stats()
+
+		assert.Equal(int64(2), stats.Taken)
+		assert.Equal(int64(1), stats.Waits)
+	})
+}
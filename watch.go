@@ -0,0 +1,39 @@
+package bucket
+
+import (
+	"fmt"
+	"time"
+)
+
+// Watch returns a channel which receives the available tokens of the bucket
+// every interval, e.g. for a live dashboard. Samples are dropped rather than
+// blocking the bucket when the receiver falls behind. The channel is closed
+// and the inner goroutine exits when the bucket is destroyed.
+func (tb *TokenBucket) Watch(interval time.Duration) <-chan int64 {
+	if interval <= 0 {
+		panic(fmt.Sprintf("ratelimit: interval %v should > 0", interval))
+	}
+
+	ch := make(chan int64, 1)
+	ticker := tb.clock.NewTicker(interval)
+
+	go func() {
+		defer close(ch)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-tb.done:
+				return
+			case <-ticker.C():
+			}
+
+			select {
+			case ch <- tb.Available():
+			default:
+			}
+		}
+	}()
+
+	return ch
+}
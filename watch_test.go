@@ -0,0 +1,47 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Should sample the available tokens until the bucket is destroyed", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		ch := b.Watch(time.Millisecond * 10)
+
+		assert.Equal(int64(10), <-ch)
+
+		b.TryTake(4)
+		<-ch
+		assert.Equal(int64(6), <-ch)
+
+		b.Destroy()
+
+		closed := make(chan struct{})
+
+		go func() {
+			for range ch {
+			}
+
+			close(closed)
+		}()
+
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatal("Watch channel is not closed after Destroy")
+		}
+	})
+
+	t.Run("Should panic when the interval is not positive", func(t *testing.T) {
+		b := New(time.Minute, 10)
+		defer b.Destroy()
+
+		assert.Panics(func() { b.Watch(0) })
+	})
+}